@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nvme_exporter/nvme"
+)
+
+// capSysAdmin is CAP_SYS_ADMIN from linux/capability.h, the kernel requires
+// it for most NVMe admin passthrough commands
+const capSysAdmin = 21
+
+// checkAccess verifies that every controller and namespace device can be
+// opened and warns if the process lacks CAP_SYS_ADMIN, instead of requiring
+// the root user
+func checkAccess(ctx context.Context, b nvme.Source) error {
+	paths, err := devicePaths(ctx, b)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		f, err := os.OpenFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			return fmt.Errorf("cannot open device: %s", err)
+		}
+		f.Close()
+	}
+	capable, err := hasCapability(capSysAdmin)
+	if err != nil {
+		log.Printf("Cannot read process capabilities: %s\n", err)
+	} else if !capable {
+		log.Println("Warning: CAP_SYS_ADMIN is not in the effective capability set, admin commands may be rejected by the kernel")
+	}
+	return nil
+}
+
+// devicePaths lists the controller and namespace devices of the backend
+func devicePaths(ctx context.Context, b nvme.Source) ([]string, error) {
+	devices, err := b.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	controllers, err := b.Controllers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, controller := range controllers {
+		paths = append(paths, controller.Path)
+	}
+	for _, device := range devices {
+		paths = append(paths, device.Path)
+	}
+	return paths, nil
+}
+
+// errUnknownDevice is returned for a device the backend does not list
+var errUnknownDevice = errors.New("unknown device")
+
+// knownDeviceBackend only runs the per-device commands on the controller and
+// namespace devices the backend lists, so that the clients of the helper and
+// the agent cannot have any other path opened. The list is read again when a
+// device is not in it, to pick up hotplugged devices.
+type knownDeviceBackend struct {
+	nvme.Source
+
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func newKnownDeviceBackend(b nvme.Source) *knownDeviceBackend {
+	return &knownDeviceBackend{Source: b, paths: map[string]bool{}}
+}
+
+func (k *knownDeviceBackend) check(ctx context.Context, device string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.paths[device] {
+		return nil
+	}
+	paths, err := devicePaths(ctx, k.Source)
+	if err != nil {
+		return err
+	}
+	k.paths = map[string]bool{}
+	for _, path := range paths {
+		k.paths[path] = true
+	}
+	if !k.paths[device] {
+		return fmt.Errorf("%w %q", errUnknownDevice, device)
+	}
+	return nil
+}
+
+func (k *knownDeviceBackend) SmartLog(ctx context.Context, device string) (*nvme.SmartLog, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.SmartLog(ctx, device)
+}
+
+func (k *knownDeviceBackend) ErrorLog(ctx context.Context, device string) ([]nvme.ErrorLogEntry, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.ErrorLog(ctx, device)
+}
+
+func (k *knownDeviceBackend) SelfTestLog(ctx context.Context, device string) (*nvme.SelfTestLog, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.SelfTestLog(ctx, device)
+}
+
+func (k *knownDeviceBackend) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	if err := k.check(ctx, device); err != nil {
+		return err
+	}
+	return k.Source.StartSelfTest(ctx, device, code)
+}
+
+func (k *knownDeviceBackend) IdentifyController(ctx context.Context, device string) (*nvme.Controller, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.IdentifyController(ctx, device)
+}
+
+func (k *knownDeviceBackend) IdentifyNamespace(ctx context.Context, device string) (*nvme.NamespaceInfo, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.IdentifyNamespace(ctx, device)
+}
+
+func (k *knownDeviceBackend) FirmwareLog(ctx context.Context, device string) (*nvme.FirmwareSlotLog, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.FirmwareLog(ctx, device)
+}
+
+func (k *knownDeviceBackend) GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error) {
+	if err := k.check(ctx, device); err != nil {
+		return 0, err
+	}
+	return k.Source.GetFeature(ctx, device, fid, cdw11)
+}
+
+func (k *knownDeviceBackend) Paths(ctx context.Context, device string) (*nvme.Multipath, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.Paths(ctx, device)
+}
+
+func (k *knownDeviceBackend) ANALog(ctx context.Context, device string) (*nvme.ANALog, error) {
+	if err := k.check(ctx, device); err != nil {
+		return nil, err
+	}
+	return k.Source.ANALog(ctx, device)
+}
+
+// hasCapability reports whether capability is in the effective set of the
+// process
+func hasCapability(capability uint) (bool, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false, err
+		}
+		return caps>>capability&1 == 1, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("no CapEff in /proc/self/status")
+}
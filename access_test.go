@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"nvme_exporter/nvme"
+)
+
+// smartLogSource serves an empty smart-log for every device
+type smartLogSource struct {
+	namespaceSource
+}
+
+func (s *smartLogSource) SmartLog(ctx context.Context, device string) (*nvme.SmartLog, error) {
+	return &nvme.SmartLog{}, nil
+}
+
+func TestKnownDeviceBackend(t *testing.T) {
+	source := &smartLogSource{namespaceSource{
+		namespaces:  []nvme.Namespace{{Path: "/dev/nvme0n1"}},
+		controllers: []nvme.ControllerDevice{{Path: "/dev/nvme0", Name: "nvme0"}},
+	}}
+	b := newKnownDeviceBackend(source)
+	ctx := context.Background()
+
+	for _, device := range []string{"/dev/nvme0", "/dev/nvme0n1"} {
+		if _, err := b.SmartLog(ctx, device); err != nil {
+			t.Errorf("%s: %s", device, err)
+		}
+	}
+	for _, device := range []string{"", "/dev/nvme1", "/dev/sda", "/dev/nvme0/../sda"} {
+		if _, err := b.SmartLog(ctx, device); !errors.Is(err, errUnknownDevice) {
+			t.Errorf("%q: got error %v, want %v", device, err, errUnknownDevice)
+		}
+	}
+
+	// a hotplugged device is found by listing again
+	source.controllers = append(source.controllers, nvme.ControllerDevice{Path: "/dev/nvme1", Name: "nvme1"})
+	if _, err := b.SmartLog(ctx, "/dev/nvme1"); err != nil {
+		t.Errorf("/dev/nvme1: %s", err)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+// The agent serves the read-only commands of a local backend as JSON over
+// HTTP so that another exporter can probe the host, see probe.go.
+
+const agentPathPrefix = "/agent/"
+
+// agentHandler serves the backend read commands under agentPathPrefix, the
+// backend is expected to reject devices it does not list, see
+// knownDeviceBackend
+type agentHandler struct {
+	backend nvme.Source
+	timeout time.Duration
+}
+
+func (h *agentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	device := r.URL.Query().Get("device")
+	var result interface{}
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, agentPathPrefix) {
+	case "devices":
+		result, err = h.backend.Namespaces(ctx)
+	case "controllers":
+		result, err = h.backend.Controllers(ctx)
+	case "smart-log":
+		result, err = h.backend.SmartLog(ctx, device)
+	case "error-log":
+		result, err = h.backend.ErrorLog(ctx, device)
+	case "self-test-log":
+		result, err = h.backend.SelfTestLog(ctx, device)
+	case "id-ctrl":
+		result, err = h.backend.IdentifyController(ctx, device)
+	case "id-ns":
+		result, err = h.backend.IdentifyNamespace(ctx, device)
+	case "fw-log":
+		result, err = h.backend.FirmwareLog(ctx, device)
+	case "paths":
+		result, err = h.backend.Paths(ctx, device)
+	case "ana-log":
+		result, err = h.backend.ANALog(ctx, device)
+	case "fabrics":
+		result, err = h.backend.FabricsControllers(ctx)
+	case "feature":
+		var fid, cdw11 uint64
+		fid, err = strconv.ParseUint(r.URL.Query().Get("fid"), 0, 8)
+		if err == nil {
+			cdw11, err = strconv.ParseUint(r.URL.Query().Get("cdw11"), 0, 32)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err = h.backend.GetFeature(ctx, device, uint8(fid), uint32(cdw11))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, errUnknownDevice) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// agentBackend reads a remote host through its agent
+type agentBackend struct {
+	baseURL string
+	client  *http.Client
+	// username and password are sent as basic auth if username is set
+	username string
+	password string
+}
+
+func newAgentBackend(target string, module *probeModule) (*agentBackend, error) {
+	tlsConfig, err := module.TLSConfig.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &agentBackend{
+		baseURL:  module.Scheme + "://" + target + agentPathPrefix,
+		client:   &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		username: module.BasicAuth.Username,
+		password: module.BasicAuth.Password,
+	}, nil
+}
+
+func (b *agentBackend) get(ctx context.Context, path string, params url.Values, result interface{}) error {
+	u := b.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error querying agent: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("agent %s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid agent %s response: %s", req.URL.Host, err)
+	}
+	return nil
+}
+
+func (b *agentBackend) Namespaces(ctx context.Context) ([]nvme.Namespace, error) {
+	var devices []nvme.Namespace
+	if err := b.get(ctx, "devices", nil, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (b *agentBackend) Controllers(ctx context.Context) ([]nvme.ControllerDevice, error) {
+	var controllers []nvme.ControllerDevice
+	if err := b.get(ctx, "controllers", nil, &controllers); err != nil {
+		return nil, err
+	}
+	return controllers, nil
+}
+
+func (b *agentBackend) SmartLog(ctx context.Context, device string) (*nvme.SmartLog, error) {
+	var smart nvme.SmartLog
+	if err := b.get(ctx, "smart-log", url.Values{"device": {device}}, &smart); err != nil {
+		return nil, err
+	}
+	return &smart, nil
+}
+
+func (b *agentBackend) ErrorLog(ctx context.Context, device string) ([]nvme.ErrorLogEntry, error) {
+	var entries []nvme.ErrorLogEntry
+	if err := b.get(ctx, "error-log", url.Values{"device": {device}}, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (b *agentBackend) SelfTestLog(ctx context.Context, device string) (*nvme.SelfTestLog, error) {
+	var selfTest nvme.SelfTestLog
+	if err := b.get(ctx, "self-test-log", url.Values{"device": {device}}, &selfTest); err != nil {
+		return nil, err
+	}
+	return &selfTest, nil
+}
+
+func (b *agentBackend) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	return fmt.Errorf("starting a self-test is not supported through the agent")
+}
+
+func (b *agentBackend) IdentifyController(ctx context.Context, device string) (*nvme.Controller, error) {
+	var info nvme.Controller
+	if err := b.get(ctx, "id-ctrl", url.Values{"device": {device}}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (b *agentBackend) IdentifyNamespace(ctx context.Context, device string) (*nvme.NamespaceInfo, error) {
+	var info nvme.NamespaceInfo
+	if err := b.get(ctx, "id-ns", url.Values{"device": {device}}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (b *agentBackend) FirmwareLog(ctx context.Context, device string) (*nvme.FirmwareSlotLog, error) {
+	var fw nvme.FirmwareSlotLog
+	if err := b.get(ctx, "fw-log", url.Values{"device": {device}}, &fw); err != nil {
+		return nil, err
+	}
+	return &fw, nil
+}
+
+func (b *agentBackend) GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error) {
+	var value uint32
+	params := url.Values{
+		"device": {device},
+		"fid":    {strconv.Itoa(int(fid))},
+		"cdw11":  {strconv.FormatUint(uint64(cdw11), 10)},
+	}
+	if err := b.get(ctx, "feature", params, &value); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (b *agentBackend) Paths(ctx context.Context, device string) (*nvme.Multipath, error) {
+	var multipath nvme.Multipath
+	if err := b.get(ctx, "paths", url.Values{"device": {device}}, &multipath); err != nil {
+		return nil, err
+	}
+	return &multipath, nil
+}
+
+func (b *agentBackend) ANALog(ctx context.Context, device string) (*nvme.ANALog, error) {
+	var log nvme.ANALog
+	if err := b.get(ctx, "ana-log", url.Values{"device": {device}}, &log); err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+func (b *agentBackend) FabricsControllers(ctx context.Context) ([]nvme.FabricsController, error) {
+	var controllers []nvme.FabricsController
+	if err := b.get(ctx, "fabrics", nil, &controllers); err != nil {
+		return nil, err
+	}
+	return controllers, nil
+}
+
+// probeTLSConfig configures the connection to agents of the https scheme
+type probeTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+func (c probeTLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca_file: %s", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
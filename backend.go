@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"nvme_exporter/nvme"
+)
+
+const (
+	backendNvmeCli = "nvme-cli"
+	backendNative  = "native"
+	backendHelper  = "helper"
+	backendFixture = "fixture"
+)
+
+// newBackend returns the named nvme.Source, helperSocket is only used by
+// the helper backend and fixtureDir by the fixture backend
+func newBackend(name string, helperSocket string, fixtureDir string) (nvme.Source, error) {
+	switch name {
+	case backendNvmeCli:
+		return nvme.CLI{}, nil
+	case backendNative:
+		return nvme.Native{}, nil
+	case backendHelper:
+		return helperBackend{socket: helperSocket}, nil
+	case backendFixture:
+		return nvme.Fixture{Dir: fixtureDir}, nil
+	}
+	return nil, fmt.Errorf("unknown backend %q", name)
+}
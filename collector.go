@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+// deviceCollector reads one source of metrics, e.g. a log page, from a device
+type deviceCollector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	// Update sends the metrics of t to ch. Metrics sent before an error is
+	// returned are discarded.
+	Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error
+}
+
+type collectorFactory func(b nvme.Source, opts collectorOptions) deviceCollector
+
+// collectorScope is what a collector reads from: controller scoped
+// collectors read log pages shared by all namespaces of the controller and
+// run once on every controller device, namespace scoped ones on every
+// namespace device and host scoped ones once per scrape
+type collectorScope int
+
+const (
+	scopeController collectorScope = iota
+	scopeNamespace
+	scopeHost
+)
+
+// target is what the collectors of its scope run on, a controller, a
+// namespace or the host
+type target struct {
+	scope      collectorScope
+	controller nvme.ControllerDevice
+	namespace  nvme.Namespace
+}
+
+// path returns the device path of t, e.g. /dev/nvme0 or /dev/nvme0n1, the
+// host has none
+func (t target) path() string {
+	switch t.scope {
+	case scopeController:
+		return t.controller.Path
+	case scopeNamespace:
+		return t.namespace.Path
+	}
+	return ""
+}
+
+type collectorRegistration struct {
+	factory  collectorFactory
+	scope    collectorScope
+	enabled  *bool
+	disabled *bool
+}
+
+var collectorRegistry = map[string]*collectorRegistration{}
+
+// registerCollector adds a collector along with its --collector.<name> and
+// --no-collector.<name> flags, it must be called from init. scope tells
+// whether it runs on every controller, every namespace or the host.
+func registerCollector(name string, isDefaultEnabled bool, scope collectorScope, factory collectorFactory) {
+	collectorRegistry[name] = &collectorRegistration{
+		factory:  factory,
+		scope:    scope,
+		enabled:  flag.Bool("collector."+name, isDefaultEnabled, fmt.Sprintf("enable the %s collector", name)),
+		disabled: flag.Bool("no-collector."+name, false, fmt.Sprintf("disable the %s collector", name)),
+	}
+}
+
+// enabledCollectors returns the sorted names of the collectors enabled by
+// the command line flags
+func enabledCollectors() []string {
+	var names []string
+	for name, r := range collectorRegistry {
+		if *r.enabled && !*r.disabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectorOptions configures newNvmeCollector
+type collectorOptions struct {
+	timeout         time.Duration
+	concurrency     int
+	collectors      []string
+	selfTestResults int
+	// legacyNames also emits the smart-log metrics under their raw spec
+	// unit names
+	legacyNames bool
+	// scrapeErrors counts the errors a collector recovers from, set by
+	// newNvmeCollector
+	scrapeErrors *prometheus.CounterVec
+	// firmwareStateFile keeps the firmware revisions seen across restarts
+	firmwareStateFile string
+}
+
+// targetPruner is implemented by collectors keeping state per device, prune
+// is called with the targets of every scrape that listed the devices so that
+// the state of removed devices can be dropped
+type targetPruner interface {
+	prune(targets []target)
+}
+
+type namedCollector struct {
+	name      string
+	scope     collectorScope
+	collector deviceCollector
+}
+
+// nvmeCollector lists the devices and runs every enabled collector on each
+// of them
+type nvmeCollector struct {
+	backend     nvme.Source
+	timeout     time.Duration
+	concurrency int
+	collectors  []namedCollector
+	snapshot    *snapshot
+
+	nvmeLastRefreshTimestamp     *prometheus.Desc
+	nvmeNamespaceControllerInfo  *prometheus.Desc
+	nvmeScrapeDeviceSuccess      *prometheus.Desc
+	nvmeScrapeDurationSeconds    *prometheus.Desc
+	nvmeCollectorSuccess         *prometheus.Desc
+	nvmeCollectorDurationSeconds *prometheus.Desc
+	nvmeScrapeErrors             *prometheus.CounterVec
+}
+
+func newNvmeCollector(b nvme.Source, opts collectorOptions) (*nvmeCollector, error) {
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+	c := &nvmeCollector{
+		backend:     b,
+		timeout:     opts.timeout,
+		concurrency: opts.concurrency,
+		nvmeLastRefreshTimestamp: prometheus.NewDesc(
+			"nvme_last_refresh_timestamp_seconds",
+			"Unix time of the last successful background refresh.",
+			nil,
+			nil,
+		),
+		nvmeNamespaceControllerInfo: prometheus.NewDesc(
+			"nvme_namespace_controller_info",
+			"The controllers and NVM subsystem the namespace device belongs to, always 1, a series per\n"+
+				"controller with native multipath. Controller metrics are labeled by controller, join on\n"+
+				"controller to find its namespaces.",
+			[]string{"device", "controller", "subsystem"},
+			nil,
+		),
+		nvmeScrapeDeviceSuccess: prometheus.NewDesc(
+			"nvme_scrape_device_success",
+			"Whether every collector succeeded on the controller or namespace device during the last\n"+
+				"scrape (1) or not (0).",
+			[]string{"device"},
+			nil,
+		),
+		nvmeScrapeDurationSeconds: prometheus.NewDesc(
+			"nvme_scrape_duration_seconds",
+			"Time it took to run every collector on the device during the last scrape.",
+			[]string{"device"},
+			nil,
+		),
+		nvmeCollectorSuccess: prometheus.NewDesc(
+			"nvme_collector_success",
+			"Whether the collector succeeded on every device during the last scrape (1) or not (0).",
+			[]string{"collector"},
+			nil,
+		),
+		nvmeCollectorDurationSeconds: prometheus.NewDesc(
+			"nvme_collector_duration_seconds",
+			"Time the collector spent on all devices during the last scrape.",
+			[]string{"collector"},
+			nil,
+		),
+		nvmeScrapeErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "nvme_scrape_errors_total",
+				Help: "Number of errors while scraping, by device and stage (list, ana_log or the collector name).",
+			},
+			[]string{"device", "stage"},
+		),
+	}
+	opts.scrapeErrors = c.nvmeScrapeErrors
+	for _, name := range opts.collectors {
+		r, ok := collectorRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		c.collectors = append(c.collectors, namedCollector{name, r.scope, r.factory(b, opts)})
+	}
+	return c, nil
+}
+
+func (c *nvmeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, nc := range c.collectors {
+		nc.collector.Describe(ch)
+	}
+	ch <- c.nvmeLastRefreshTimestamp
+	ch <- c.nvmeNamespaceControllerInfo
+	ch <- c.nvmeScrapeDeviceSuccess
+	ch <- c.nvmeScrapeDurationSeconds
+	ch <- c.nvmeCollectorSuccess
+	ch <- c.nvmeCollectorDurationSeconds
+	c.nvmeScrapeErrors.Describe(ch)
+}
+
+func (c *nvmeCollector) Collect(ch chan<- prometheus.Metric) {
+	defer c.nvmeScrapeErrors.Collect(ch)
+
+	if c.snapshot != nil {
+		c.collectSnapshot(ch)
+		return
+	}
+	states, _ := c.scrape()
+	c.collectStates(ch, states)
+}
+
+// deviceState is the outcome of reading a single device
+type deviceState struct {
+	target   target
+	success  bool
+	duration time.Duration
+	// results holds the outcome of each collector by name
+	results map[string]*collectorResult
+}
+
+// collectorResult is the outcome of running one collector on a device
+type collectorResult struct {
+	success  bool
+	duration time.Duration
+	metrics  []prometheus.Metric
+	// refreshed is when the collector last succeeded on the device
+	refreshed time.Time
+}
+
+// inherit fills in the metrics of the collectors that failed this time
+// from prev
+func (s *deviceState) inherit(prev *deviceState) {
+	for name, result := range s.results {
+		if result.success {
+			continue
+		}
+		if p, ok := prev.results[name]; ok {
+			result.metrics = p.metrics
+			result.refreshed = p.refreshed
+		}
+	}
+}
+
+// withoutStale returns a copy of s without the metrics of collectors that
+// have not succeeded since cutoff
+func (s *deviceState) withoutStale(cutoff time.Time) *deviceState {
+	state := &deviceState{target: s.target, success: s.success, duration: s.duration, results: map[string]*collectorResult{}}
+	for name, result := range s.results {
+		if result.refreshed.Before(cutoff) {
+			result = &collectorResult{success: result.success, duration: result.duration}
+		}
+		state.results[name] = result
+	}
+	return state
+}
+
+// scrape reads the host and every controller and namespace, the second
+// return value is false if the devices could not be listed. The host is
+// read either way, e.g. fabrics controllers that lost their connection can
+// make listing the devices fail.
+func (c *nvmeCollector) scrape() ([]*deviceState, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	targets, err := c.targets(ctx)
+	cancel()
+	ok := true
+	if err != nil {
+		log.Printf("Error listing nvme devices: %s\n", err)
+		c.nvmeScrapeErrors.WithLabelValues("", "list").Inc()
+		ok = false
+	} else {
+		for _, nc := range c.collectors {
+			if p, ok := nc.collector.(targetPruner); ok {
+				p.prune(targets)
+			}
+		}
+	}
+	targets = append([]target{{scope: scopeHost}}, targets...)
+
+	// bounded worker pool, at most c.concurrency devices are read at once
+	states := make([]*deviceState, len(targets))
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+	for idx, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, t target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			states[idx] = c.scrapeTarget(t)
+		}(idx, t)
+	}
+	wg.Wait()
+	return states, ok
+}
+
+// targets lists the controllers followed by the namespaces
+func (c *nvmeCollector) targets(ctx context.Context) ([]target, error) {
+	controllers, err := c.backend.Controllers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := c.backend.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, 0, len(controllers)+len(namespaces))
+	for _, controller := range controllers {
+		targets = append(targets, target{scope: scopeController, controller: controller})
+	}
+	for _, namespace := range namespaces {
+		targets = append(targets, target{scope: scopeNamespace, namespace: namespace})
+	}
+	return targets, nil
+}
+
+// scrapeTarget runs the collectors of the scope of t on it
+func (c *nvmeCollector) scrapeTarget(t target) *deviceState {
+	start := time.Now()
+	state := &deviceState{target: t, success: true, results: map[string]*collectorResult{}}
+	for _, nc := range c.collectors {
+		if nc.scope != t.scope {
+			continue
+		}
+		result := c.update(nc, t)
+		if !result.success {
+			state.success = false
+		}
+		state.results[nc.name] = result
+	}
+	state.duration = time.Since(start)
+	return state
+}
+
+// update runs a single collector on t with its own timeout
+func (c *nvmeCollector) update(nc namedCollector, t target) *collectorResult {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := &collectorResult{}
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range ch {
+			result.metrics = append(result.metrics, m)
+		}
+		close(done)
+	}()
+	err := nc.collector.Update(ctx, t, ch)
+	close(ch)
+	<-done
+	result.duration = time.Since(start)
+
+	if err != nil {
+		log.Printf("%s\n", err)
+		c.nvmeScrapeErrors.WithLabelValues(t.path(), nc.name).Inc()
+		result.metrics = nil
+		return result
+	}
+	result.success = true
+	result.refreshed = time.Now()
+	return result
+}
+
+// collectStates exports the per collector status summed up over all devices
+// followed by the metrics of every device
+func (c *nvmeCollector) collectStates(ch chan<- prometheus.Metric, states []*deviceState) {
+	for _, nc := range c.collectors {
+		success := 1.0
+		var duration time.Duration
+		for _, state := range states {
+			result, ok := state.results[nc.name]
+			if !ok {
+				continue
+			}
+			if !result.success {
+				success = 0
+			}
+			duration += result.duration
+		}
+		ch <- prometheus.MustNewConstMetric(c.nvmeCollectorSuccess, prometheus.GaugeValue, success, nc.name)
+		ch <- prometheus.MustNewConstMetric(c.nvmeCollectorDurationSeconds, prometheus.GaugeValue, duration.Seconds(), nc.name)
+	}
+	for _, state := range states {
+		c.collectDevice(ch, state)
+	}
+}
+
+func (c *nvmeCollector) collectDevice(ch chan<- prometheus.Metric, state *deviceState) {
+	success := 0.0
+	if state.success {
+		success = 1
+	}
+	if state.target.scope != scopeHost {
+		ch <- prometheus.MustNewConstMetric(c.nvmeScrapeDurationSeconds, prometheus.GaugeValue, state.duration.Seconds(), state.target.path())
+		ch <- prometheus.MustNewConstMetric(c.nvmeScrapeDeviceSuccess, prometheus.GaugeValue, success, state.target.path())
+	}
+	if state.target.scope == scopeNamespace {
+		namespace := state.target.namespace
+		for _, controller := range namespace.Controllers {
+			ch <- prometheus.MustNewConstMetric(c.nvmeNamespaceControllerInfo, prometheus.GaugeValue, 1, namespace.Path, controller, namespace.Subsystem)
+		}
+	}
+
+	for _, nc := range c.collectors {
+		if result, ok := state.results[nc.name]; ok {
+			for _, m := range result.metrics {
+				ch <- m
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+
+	"nvme_exporter/nvme"
+)
+
+// config is the --config.file contents
+type config struct {
+	Devices struct {
+		Include deviceMatchConfig `yaml:"include"`
+		Exclude deviceMatchConfig `yaml:"exclude"`
+	} `yaml:"devices"`
+	// Modules are the /probe modules by name
+	Modules map[string]*probeModule `yaml:"modules"`
+}
+
+// deviceMatchConfig holds a list of regexps per device attribute, empty
+// fields are not checked
+type deviceMatchConfig struct {
+	Path   regexpList `yaml:"path"`
+	Model  regexpList `yaml:"model"`
+	Serial regexpList `yaml:"serial"`
+	NQN    regexpList `yaml:"nqn"`
+}
+
+// regexpList is a list of regexps, a single regexp may be given as a string
+type regexpList []string
+
+func (l *regexpList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = regexpList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func loadConfig(filename string) (*config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %s", filename, err)
+	}
+	return &cfg, nil
+}
+
+type deviceMatcher struct {
+	path, model, serial, nqn []*regexp.Regexp
+}
+
+func newDeviceMatcher(c deviceMatchConfig) (*deviceMatcher, error) {
+	var m deviceMatcher
+	for _, field := range []struct {
+		res   *[]*regexp.Regexp
+		exprs regexpList
+	}{
+		{&m.path, c.Path},
+		{&m.model, c.Model},
+		{&m.serial, c.Serial},
+		{&m.nqn, c.NQN},
+	} {
+		for _, expr := range field.exprs {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid device regexp %q: %s", expr, err)
+			}
+			*field.res = append(*field.res, re)
+		}
+	}
+	return &m, nil
+}
+
+// fields pairs the regexps of every attribute with its value for device
+func (m *deviceMatcher) fields(device nvme.Namespace) []struct {
+	res   []*regexp.Regexp
+	value string
+} {
+	return []struct {
+		res   []*regexp.Regexp
+		value string
+	}{
+		{m.path, device.Path},
+		{m.model, device.Model},
+		{m.serial, device.Serial},
+		{m.nqn, device.NQN},
+	}
+}
+
+// matchList reports whether any of res matches value
+func matchList(res []*regexp.Regexp, value string) bool {
+	for _, re := range res {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAll reports whether every configured attribute of device matches
+// one of its regexps
+func (m *deviceMatcher) matchAll(device nvme.Namespace) bool {
+	for _, field := range m.fields(device) {
+		if len(field.res) > 0 && !matchList(field.res, field.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether any regexp of any attribute matches device
+func (m *deviceMatcher) matchAny(device nvme.Namespace) bool {
+	for _, field := range m.fields(device) {
+		if matchList(field.res, field.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// empty reports whether no regexp is configured
+func (m *deviceMatcher) empty() bool {
+	return len(m.path) == 0 && len(m.model) == 0 && len(m.serial) == 0 && len(m.nqn) == 0
+}
+
+// filterBackend drops devices from the device list before any per-device
+// command is run. A device is kept if each attribute with include regexps
+// matches one of them and no exclude regexp matches any attribute. A
+// controller is kept if one of its namespaces is, a fabrics controller also
+// if a namespace of its subsystem NQN is.
+type filterBackend struct {
+	nvme.Source
+	include *deviceMatcher
+	exclude *deviceMatcher
+}
+
+func newFilterBackend(b nvme.Source, cfg *config) (nvme.Source, error) {
+	include, err := newDeviceMatcher(cfg.Devices.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := newDeviceMatcher(cfg.Devices.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &filterBackend{Source: b, include: include, exclude: exclude}, nil
+}
+
+func (f *filterBackend) Namespaces(ctx context.Context) ([]nvme.Namespace, error) {
+	devices, err := f.Source.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filtered := devices[:0]
+	for _, device := range devices {
+		if f.include.matchAll(device) && !f.exclude.matchAny(device) {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered, nil
+}
+
+func (f *filterBackend) Controllers(ctx context.Context) ([]nvme.ControllerDevice, error) {
+	controllers, err := f.Source.Controllers(ctx)
+	if err != nil || (f.include.empty() && f.exclude.empty()) {
+		return controllers, err
+	}
+	kept, _, err := f.kept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filtered := controllers[:0]
+	for _, controller := range controllers {
+		if kept[controller.Name] {
+			filtered = append(filtered, controller)
+		}
+	}
+	return filtered, nil
+}
+
+func (f *filterBackend) FabricsControllers(ctx context.Context) ([]nvme.FabricsController, error) {
+	controllers, err := f.Source.FabricsControllers(ctx)
+	if err != nil || (f.include.empty() && f.exclude.empty()) {
+		return controllers, err
+	}
+	kept, nqns, err := f.kept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filtered := controllers[:0]
+	for _, controller := range controllers {
+		if kept[controller.Name] || nqns[controller.SubsystemNQN] {
+			filtered = append(filtered, controller)
+		}
+	}
+	return filtered, nil
+}
+
+// kept returns the controller names and subsystem NQNs of the namespaces
+// passing the filters
+func (f *filterBackend) kept(ctx context.Context) (map[string]bool, map[string]bool, error) {
+	devices, err := f.Namespaces(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	controllers := map[string]bool{}
+	nqns := map[string]bool{}
+	for _, device := range devices {
+		for _, controller := range device.Controllers {
+			controllers[controller] = true
+		}
+		if device.NQN != "" {
+			nqns[device.NQN] = true
+		}
+	}
+	return controllers, nqns, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"nvme_exporter/nvme"
+)
+
+// namespaceSource lists a fixed set of namespaces and controllers
+type namespaceSource struct {
+	nvme.Source
+	namespaces  []nvme.Namespace
+	controllers []nvme.ControllerDevice
+	fabrics     []nvme.FabricsController
+}
+
+func (s namespaceSource) Namespaces(ctx context.Context) ([]nvme.Namespace, error) {
+	return append([]nvme.Namespace(nil), s.namespaces...), nil
+}
+
+func (s namespaceSource) Controllers(ctx context.Context) ([]nvme.ControllerDevice, error) {
+	return append([]nvme.ControllerDevice(nil), s.controllers...), nil
+}
+
+func (s namespaceSource) FabricsControllers(ctx context.Context) ([]nvme.FabricsController, error) {
+	return append([]nvme.FabricsController(nil), s.fabrics...), nil
+}
+
+func TestFilterBackend(t *testing.T) {
+	source := namespaceSource{
+		namespaces: []nvme.Namespace{
+			{Path: "/dev/nvme0n1", Model: "Samsung SSD 970 EVO", Serial: "S1", NQN: "nqn.2014.08.org.nvmexpress:samsung", Controllers: []string{"nvme0"}},
+			{Path: "/dev/nvme1n1", Model: "INTEL SSDPE2KX010T8", Serial: "I1", NQN: "nqn.2014.08.org.nvmexpress:intel", Controllers: []string{"nvme1"}},
+			{Path: "/dev/nvme2n1", Model: "Micron_7450", Serial: "M1", NQN: "nqn.2014-08.org.nvmexpress:appliance", Controllers: []string{"nvme2"}},
+		},
+		// nvme3 is connecting and lists no namespaces
+		fabrics: []nvme.FabricsController{
+			{Name: "nvme2", SubsystemNQN: "nqn.2014-08.org.nvmexpress:appliance"},
+			{Name: "nvme3", SubsystemNQN: "nqn.2014-08.org.nvmexpress:appliance"},
+			{Name: "nvme4", SubsystemNQN: "nqn.2014-08.org.nvmexpress:other"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		config  string
+		want    []string
+		fabrics []string
+	}{
+		{
+			name:    "empty",
+			want:    []string{"/dev/nvme0n1", "/dev/nvme1n1", "/dev/nvme2n1"},
+			fabrics: []string{"nvme2", "nvme3", "nvme4"},
+		},
+		{
+			name:    "fabrics controllers of the kept subsystems",
+			config:  "include: {nqn: appliance}",
+			want:    []string{"/dev/nvme2n1"},
+			fabrics: []string{"nvme2", "nvme3"},
+		},
+		{
+			name:   "include single",
+			config: "include: {model: '^Samsung'}",
+			want:   []string{"/dev/nvme0n1"},
+		},
+		{
+			name:   "include list",
+			config: "include: {model: ['^Samsung', '^INTEL']}",
+			want:   []string{"/dev/nvme0n1", "/dev/nvme1n1"},
+		},
+		{
+			name:   "include all fields must match",
+			config: "include: {model: ['^Samsung', '^INTEL'], serial: '^I'}",
+			want:   []string{"/dev/nvme1n1"},
+		},
+		{
+			name:   "exclude any field",
+			config: "exclude: {path: '^/dev/nvme0n1$', nqn: 'appliance'}",
+			want:   []string{"/dev/nvme1n1"},
+		},
+		{
+			name:   "exclude list",
+			config: "exclude: {serial: ['^S', '^M']}",
+			want:   []string{"/dev/nvme1n1"},
+		},
+		{
+			name:   "include and exclude",
+			config: "include: {path: [nvme0, nvme2]}, exclude: {model: Micron}",
+			want:   []string{"/dev/nvme0n1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg config
+			if err := yaml.UnmarshalStrict([]byte("devices: {"+tc.config+"}"), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			b, err := newFilterBackend(source, &cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			devices, err := b.Namespaces(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, device := range devices {
+				got = append(got, device.Path)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+
+			fabrics, err := b.FabricsControllers(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = nil
+			for _, controller := range fabrics {
+				got = append(got, controller.Name)
+			}
+			if !reflect.DeepEqual(got, tc.fabrics) {
+				t.Errorf("got fabrics controllers %v, want %v", got, tc.fabrics)
+			}
+		})
+	}
+}
+
+func TestFilterBackendInvalidRegexp(t *testing.T) {
+	var cfg config
+	cfg.Devices.Include.Model = regexpList{"^Samsung", "("}
+	if _, err := newFilterBackend(namespaceSource{}, &cfg); err == nil {
+		t.Error("got no error for an invalid regexp")
+	}
+}
+
+func TestFilterBackendControllers(t *testing.T) {
+	source := namespaceSource{
+		namespaces: []nvme.Namespace{
+			{Path: "/dev/nvme0n1", Controllers: []string{"nvme0"}},
+			{Path: "/dev/nvme0n2", Controllers: []string{"nvme0"}},
+			{Path: "/dev/nvme1n1", Controllers: []string{"nvme1", "nvme2"}},
+		},
+		controllers: []nvme.ControllerDevice{{Name: "nvme0"}, {Name: "nvme1"}, {Name: "nvme2"}, {Name: "nvme3"}},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "empty",
+			want: []string{"nvme0", "nvme1", "nvme2", "nvme3"},
+		},
+		{
+			name:   "one namespace of the controller kept",
+			config: "exclude: {path: 'nvme0n1'}",
+			want:   []string{"nvme0", "nvme1", "nvme2"},
+		},
+		{
+			name:   "every path of a multipath namespace",
+			config: "include: {path: 'nvme1n1'}",
+			want:   []string{"nvme1", "nvme2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg config
+			if err := yaml.UnmarshalStrict([]byte("devices: {"+tc.config+"}"), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			b, err := newFilterBackend(source, &cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			controllers, err := b.Controllers(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, controller := range controllers {
+				got = append(got, controller.Name)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+type errorLogKey struct {
+	queue          string
+	statusCodeType uint16
+	statusCode     uint16
+}
+
+type errorCountSeen struct {
+	count uint64
+	// changed is when count was observed to differ from the count seen
+	// before, zero until then
+	changed time.Time
+}
+
+func init() {
+	registerCollector("error-log", true, scopeController, newErrorLogCollector)
+}
+
+// errorLogCollector exports the Error Information log page
+type errorLogCollector struct {
+	backend nvme.Source
+
+	nvmeErrorLogEntries              *prometheus.Desc
+	nvmeErrorLogLatestErrorCount     *prometheus.Desc
+	nvmeErrorLogLatestErrorTimestamp *prometheus.Desc
+
+	mu   sync.Mutex
+	seen map[string]errorCountSeen
+}
+
+func newErrorLogCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &errorLogCollector{
+		backend: b,
+		nvmeErrorLogEntries: prometheus.NewDesc(
+			"nvme_error_log_entries",
+			"Number of entries in the Error Information log page by submission queue, status code type and status code.",
+			[]string{"controller", "subsystem", "queue", "status_code_type", "status_code"},
+			nil,
+		),
+		nvmeErrorLogLatestErrorCount: prometheus.NewDesc(
+			"nvme_error_log_latest_error_count",
+			"Error Count of the most recent entry in the Error Information log page.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		nvmeErrorLogLatestErrorTimestamp: prometheus.NewDesc(
+			"nvme_error_log_latest_error_timestamp_seconds",
+			"Unix time at which the exporter observed the latest Error Count change between two reads of the log page.\n"+
+				"Missing until a change has been observed, the log page carries no timestamp.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		seen: map[string]errorCountSeen{},
+	}
+}
+
+func (m *errorLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeErrorLogEntries
+	ch <- m.nvmeErrorLogLatestErrorCount
+	ch <- m.nvmeErrorLogLatestErrorTimestamp
+}
+
+// observe records the latest error count of controller and returns the time
+// it was observed to change, zero if it has not changed since first seen
+func (m *errorLogCollector) observe(controller string, count uint64, now time.Time) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen, ok := m.seen[controller]
+	if ok && seen.count == count {
+		return seen.changed
+	}
+	seen = errorCountSeen{count: count}
+	if ok {
+		seen.changed = now
+	}
+	m.seen[controller] = seen
+	return seen.changed
+}
+
+// prune forgets the controllers that are no longer listed
+func (m *errorLogCollector) prune(targets []target) {
+	listed := map[string]bool{}
+	for _, t := range targets {
+		if t.scope == scopeController {
+			listed[t.controller.Path] = true
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for controller := range m.seen {
+		if !listed[controller] {
+			delete(m.seen, controller)
+		}
+	}
+}
+
+func (m *errorLogCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	entries, err := m.backend.ErrorLog(ctx, controller.Path)
+	if err != nil {
+		return err
+	}
+	latestErrorTime := m.observe(controller.Path, nvme.LatestErrorCount(entries), time.Now())
+
+	counts := map[errorLogKey]float64{}
+	for _, e := range entries {
+		if e.ErrorCount == 0 {
+			continue
+		}
+		counts[errorLogKey{e.Queue(), e.StatusCodeType(), e.StatusCode()}]++
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(m.nvmeErrorLogEntries, prometheus.GaugeValue, count,
+			controller.Name, controller.Subsystem, key.queue, nvme.StatusCodeTypeName(key.statusCodeType), fmt.Sprintf("0x%02x", key.statusCode))
+	}
+	ch <- prometheus.MustNewConstMetric(m.nvmeErrorLogLatestErrorCount, prometheus.GaugeValue, float64(nvme.LatestErrorCount(entries)), controller.Name, controller.Subsystem)
+	if !latestErrorTime.IsZero() {
+		ch <- prometheus.MustNewConstMetric(m.nvmeErrorLogLatestErrorTimestamp, prometheus.GaugeValue, float64(latestErrorTime.UnixNano())/1e9, controller.Name, controller.Subsystem)
+	}
+	return nil
+}
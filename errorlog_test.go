@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+func TestErrorLogCollectorObserve(t *testing.T) {
+	m := newErrorLogCollector(nil, collectorOptions{}).(*errorLogCollector)
+	start := time.Unix(1700000000, 0)
+
+	// the errors in the log at startup are not new
+	if changed := m.observe("/dev/nvme0", 12, start); !changed.IsZero() {
+		t.Errorf("got change at %s for a controller seen the first time", changed)
+	}
+	at := start.Add(time.Minute)
+	if changed := m.observe("/dev/nvme0", 13, at); !changed.Equal(at) {
+		t.Errorf("got change at %s, want %s", changed, at)
+	}
+	if changed := m.observe("/dev/nvme0", 13, at.Add(time.Minute)); !changed.Equal(at) {
+		t.Errorf("got change at %s for an unchanged count, want %s", changed, at)
+	}
+
+	m.observe("/dev/nvme1", 1, start)
+	m.prune([]target{{scope: scopeController, controller: nvme.ControllerDevice{Path: "/dev/nvme0"}}})
+	if _, ok := m.seen["/dev/nvme1"]; ok {
+		t.Error("the state of a removed controller was kept")
+	}
+	if _, ok := m.seen["/dev/nvme0"]; !ok {
+		t.Error("the state of a listed controller was dropped")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+// fabricsStates are the controller states of the Linux host driver, always
+// exported so that alerts can match on a state that is not current
+var fabricsStates = []string{"new", "live", "resetting", "connecting", "deleting", "deleting (noio)", "dead"}
+
+func init() {
+	registerCollector("fabrics", true, scopeHost, newFabricsCollector)
+}
+
+// fabricsCollector exports the NVMe over Fabrics controllers of the host.
+// It is host scoped as it reads sysfs only, controllers that lost their
+// connection can not be read through.
+type fabricsCollector struct {
+	backend nvme.Source
+
+	nvmeFabricsControllerInfo  *prometheus.Desc
+	nvmeFabricsControllerState *prometheus.Desc
+	nvmeFabricsReconnects      *prometheus.Desc
+
+	mu sync.Mutex
+	// states holds the state each controller was last seen in
+	states     map[string]string
+	reconnects map[string]float64
+}
+
+func newFabricsCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &fabricsCollector{
+		backend: b,
+		nvmeFabricsControllerInfo: prometheus.NewDesc(
+			"nvme_fabrics_controller_info",
+			"Transport and addresses of the NVMe over Fabrics controller, always 1.",
+			[]string{"controller", "subsystem", "transport", "traddr", "trsvcid", "host_traddr", "host_nqn", "subsystem_nqn"},
+			nil,
+		),
+		nvmeFabricsControllerState: prometheus.NewDesc(
+			"nvme_fabrics_controller_state",
+			"Whether the NVMe over Fabrics controller is in the state (1) or not (0). A controller\n"+
+				"that lost its connection is connecting until it reconnects or ctrl_loss_tmo expires.",
+			[]string{"controller", "state"},
+			nil,
+		),
+		nvmeFabricsReconnects: prometheus.NewDesc(
+			"nvme_fabrics_reconnects_total",
+			"Number of times the exporter observed the NVMe over Fabrics controller become live again\n"+
+				"after being seen in another state. The kernel does not count reconnects, a reconnect\n"+
+				"that completes between two scrapes is not observed.",
+			[]string{"controller"},
+			nil,
+		),
+		states:     map[string]string{},
+		reconnects: map[string]float64{},
+	}
+}
+
+func (m *fabricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeFabricsControllerInfo
+	ch <- m.nvmeFabricsControllerState
+	ch <- m.nvmeFabricsReconnects
+}
+
+// observe records the state of controller and returns its reconnect count
+func (m *fabricsCollector) observe(controller string, state string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prev, ok := m.states[controller]; ok && prev != "live" && state == "live" {
+		m.reconnects[controller]++
+	}
+	m.states[controller] = state
+	return m.reconnects[controller]
+}
+
+func (m *fabricsCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controllers, err := m.backend.FabricsControllers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range controllers {
+		ch <- prometheus.MustNewConstMetric(m.nvmeFabricsControllerInfo, prometheus.GaugeValue, 1,
+			c.Name, c.Subsystem, c.Transport, c.TrAddr, c.TrSvcID, c.HostTrAddr, c.HostNQN, c.SubsystemNQN)
+		known := false
+		for _, state := range fabricsStates {
+			value := 0.0
+			if state == c.State {
+				value = 1
+				known = true
+			}
+			ch <- prometheus.MustNewConstMetric(m.nvmeFabricsControllerState, prometheus.GaugeValue, value, c.Name, state)
+		}
+		if !known && c.State != "" {
+			ch <- prometheus.MustNewConstMetric(m.nvmeFabricsControllerState, prometheus.GaugeValue, 1, c.Name, c.State)
+		}
+		ch <- prometheus.MustNewConstMetric(m.nvmeFabricsReconnects, prometheus.CounterValue, m.observe(c.Name, c.State), c.Name)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestFabricsReconnects(t *testing.T) {
+	m := newFabricsCollector(nil, collectorOptions{}).(*fabricsCollector)
+	for _, tc := range []struct {
+		state string
+		want  float64
+	}{
+		// the first observation is not a reconnect
+		{"live", 0},
+		{"live", 0},
+		{"connecting", 0},
+		{"connecting", 0},
+		{"live", 1},
+		{"resetting", 1},
+		{"live", 2},
+	} {
+		if got := m.observe("nvme1", tc.state); got != tc.want {
+			t.Errorf("observe(%s) = %v, want %v", tc.state, got, tc.want)
+		}
+	}
+	if got := m.observe("nvme2", "live"); got != 0 {
+		t.Errorf("observe of another controller = %v, want 0", got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+func init() {
+	registerCollector("temperature-threshold", true, scopeController, newTemperatureThresholdCollector)
+}
+
+// temperatureThresholdCollector exports the Temperature Threshold feature
+type temperatureThresholdCollector struct {
+	backend nvme.Source
+
+	nvmeTemperatureThresholdCelsius *prometheus.Desc
+}
+
+func newTemperatureThresholdCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &temperatureThresholdCollector{
+		backend: b,
+		nvmeTemperatureThresholdCelsius: prometheus.NewDesc(
+			"nvme_temperature_threshold_celsius",
+			"Temperature Threshold (Feature Identifier 04h): the host configurable over and under\n"+
+				"temperature thresholds of the Composite Temperature. An asynchronous event may be\n"+
+				"generated when the temperature crosses the threshold. Thresholds of 0 Kelvin are omitted.",
+			[]string{"controller", "subsystem", "type"},
+			nil,
+		),
+	}
+}
+
+func (m *temperatureThresholdCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeTemperatureThresholdCelsius
+}
+
+func (m *temperatureThresholdCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	thresholds, err := nvme.ReadTemperatureThresholds(ctx, m.backend, controller.Path)
+	if err != nil {
+		return err
+	}
+	if thresholds.Over != 0 {
+		ch <- prometheus.MustNewConstMetric(m.nvmeTemperatureThresholdCelsius, prometheus.GaugeValue, kelvinToCelsius(float64(thresholds.Over)), controller.Name, controller.Subsystem, "over")
+	}
+	if thresholds.Under != 0 {
+		ch <- prometheus.MustNewConstMetric(m.nvmeTemperatureThresholdCelsius, prometheus.GaugeValue, kelvinToCelsius(float64(thresholds.Under)), controller.Name, controller.Subsystem, "under")
+	}
+	return nil
+}
+
+// kelvinToCelsius converts the integer Kelvin temperatures reported by NVMe
+// controllers, the specification uses 273 as the offset
+func kelvinToCelsius(kelvin float64) float64 {
+	return kelvin - 273
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+// firmwareSeen is the active firmware revision last observed on a drive, as
+// stored in the state file
+type firmwareSeen struct {
+	Revision string `json:"revision"`
+	// Changed is when the revision was observed to differ from the one seen
+	// before, zero until then
+	Changed time.Time `json:"changed"`
+}
+
+func init() {
+	registerCollector("firmware", true, scopeController, newFirmwareCollector)
+}
+
+// firmwareCollector exports the Firmware Slot Information log page
+type firmwareCollector struct {
+	backend nvme.Source
+	// stateFile keeps seen across restarts if set
+	stateFile string
+
+	nvmeFirmwareActiveSlot       *prometheus.Desc
+	nvmeFirmwarePendingSlot      *prometheus.Desc
+	nvmeFirmwareSlotInfo         *prometheus.Desc
+	nvmeFirmwareChangedTimestamp *prometheus.Desc
+
+	mu sync.Mutex
+	// seen is keyed by serial number, which unlike the controller name
+	// survives reboots and fabrics reconnects
+	seen map[string]firmwareSeen
+}
+
+func newFirmwareCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	m := &firmwareCollector{
+		backend:   b,
+		stateFile: opts.firmwareStateFile,
+		nvmeFirmwareActiveSlot: prometheus.NewDesc(
+			"nvme_firmware_active_slot",
+			"Active Firmware Info (AFI): the firmware slot from which the actively running\n"+
+				"firmware revision was loaded.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		nvmeFirmwarePendingSlot: prometheus.NewDesc(
+			"nvme_firmware_pending_slot",
+			"Active Firmware Info (AFI): the firmware slot that is going to be activated at the\n"+
+				"next Controller Level Reset, 0 if no firmware activation is pending.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		nvmeFirmwareSlotInfo: prometheus.NewDesc(
+			"nvme_firmware_slot_info",
+			"Firmware Revision for Slot: the revision of the firmware in the slot, always 1.\n"+
+				"Only present for slots that contain a firmware image.",
+			[]string{"controller", "subsystem", "slot", "revision"},
+			nil,
+		),
+		nvmeFirmwareChangedTimestamp: prometheus.NewDesc(
+			"nvme_firmware_changed_timestamp_seconds",
+			"Unix time at which the exporter observed the revision of the active firmware slot change\n"+
+				"from the revision seen before. Missing until a change has been observed.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		seen: map[string]firmwareSeen{},
+	}
+	if err := m.load(); err != nil {
+		log.Printf("Error reading firmware state file: %s\n", err)
+	}
+	return m
+}
+
+func (m *firmwareCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeFirmwareActiveSlot
+	ch <- m.nvmeFirmwarePendingSlot
+	ch <- m.nvmeFirmwareSlotInfo
+	ch <- m.nvmeFirmwareChangedTimestamp
+}
+
+// firmwareKey identifies the drive of controller in seen
+func firmwareKey(controller nvme.ControllerDevice) string {
+	if controller.Serial != "" {
+		return controller.Serial
+	}
+	return controller.Path
+}
+
+// observe records the active firmware revision of the drive and returns the
+// time it was observed to change, zero if it has not changed since first
+// seen
+func (m *firmwareCollector) observe(key string, revision string, now time.Time) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen, ok := m.seen[key]
+	if ok && seen.Revision == revision {
+		return seen.Changed
+	}
+	seen = firmwareSeen{Revision: revision}
+	if ok {
+		seen.Changed = now
+	}
+	m.seen[key] = seen
+	m.save()
+	return seen.Changed
+}
+
+// prune forgets the drives that are no longer listed
+func (m *firmwareCollector) prune(targets []target) {
+	listed := map[string]bool{}
+	for _, t := range targets {
+		if t.scope == scopeController {
+			listed[firmwareKey(t.controller)] = true
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pruned := false
+	for key := range m.seen {
+		if !listed[key] {
+			delete(m.seen, key)
+			pruned = true
+		}
+	}
+	if pruned {
+		m.save()
+	}
+}
+
+// load reads seen from the state file, a missing file is not an error
+func (m *firmwareCollector) load() error {
+	if m.stateFile == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(m.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &m.seen)
+}
+
+// save replaces the state file with seen, called with mu held. A failed
+// write is logged, the next change retries it.
+func (m *firmwareCollector) save() {
+	if m.stateFile == "" {
+		return
+	}
+	content, err := json.Marshal(m.seen)
+	if err != nil {
+		log.Printf("Error writing firmware state file: %s\n", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.stateFile), filepath.Base(m.stateFile)+".tmp")
+	if err != nil {
+		log.Printf("Error writing firmware state file: %s\n", err)
+		return
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), m.stateFile)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Error writing firmware state file: %s\n", err)
+	}
+}
+
+func (m *firmwareCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	fw, err := m.backend.FirmwareLog(ctx, controller.Path)
+	if err != nil {
+		return err
+	}
+	changed := m.observe(firmwareKey(controller), fw.ActiveRevision(), time.Now())
+
+	ch <- prometheus.MustNewConstMetric(m.nvmeFirmwareActiveSlot, prometheus.GaugeValue, float64(fw.ActiveSlot), controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(m.nvmeFirmwarePendingSlot, prometheus.GaugeValue, float64(fw.PendingSlot), controller.Name, controller.Subsystem)
+	for idx, revision := range fw.Revisions {
+		if revision == "" {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.nvmeFirmwareSlotInfo, prometheus.GaugeValue, 1, controller.Name, controller.Subsystem, strconv.Itoa(idx+1), revision)
+	}
+	if !changed.IsZero() {
+		ch <- prometheus.MustNewConstMetric(m.nvmeFirmwareChangedTimestamp, prometheus.GaugeValue, float64(changed.UnixNano())/1e9, controller.Name, controller.Subsystem)
+	}
+	return nil
+}
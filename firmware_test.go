@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+func TestFirmwareCollectorObserve(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "firmware.json")
+	newCollector := func() *firmwareCollector {
+		return newFirmwareCollector(nil, collectorOptions{firmwareStateFile: stateFile}).(*firmwareCollector)
+	}
+	start := time.Unix(1700000000, 0)
+
+	m := newCollector()
+	if changed := m.observe("S1", "1.0", start); !changed.IsZero() {
+		t.Errorf("got change at %s for a drive seen the first time", changed)
+	}
+	if changed := m.observe("S1", "1.0", start.Add(time.Minute)); !changed.IsZero() {
+		t.Errorf("got change at %s for an unchanged revision", changed)
+	}
+
+	// the revision changes while the exporter restarts for the reboot
+	// activating it
+	m = newCollector()
+	at := start.Add(time.Hour)
+	if changed := m.observe("S1", "2.0", at); !changed.Equal(at) {
+		t.Errorf("got change at %s, want %s", changed, at)
+	}
+	m = newCollector()
+	if changed := m.observe("S1", "2.0", at.Add(time.Hour)); !changed.Equal(at) {
+		t.Errorf("got change at %s after a restart, want %s", changed, at)
+	}
+
+	// a fabrics reconnect gets a new controller name but keeps the serial
+	controller := nvme.ControllerDevice{Path: "/dev/nvme3", Name: "nvme3", Serial: "S1"}
+	m.observe("S2", "1.0", at)
+	m.prune([]target{{scope: scopeController, controller: controller}})
+	if _, ok := m.seen["S2"]; ok {
+		t.Error("the state of a removed drive was kept")
+	}
+	if _, ok := newCollector().seen["S1"]; !ok {
+		t.Error("the state of a listed drive was dropped")
+	}
+}
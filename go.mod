@@ -4,5 +4,8 @@ go 1.16
 
 require (
 	github.com/prometheus/client_golang v1.11.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/tidwall/gjson v1.8.1
+	golang.org/x/crypto v0.8.0
+	gopkg.in/yaml.v2 v2.4.0
 )
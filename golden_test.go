@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files from the current output")
+
+// volatileMetrics vary between runs, their samples are left out of the
+// golden files
+var volatileMetrics = []string{
+	"nvme_scrape_duration_seconds",
+	"nvme_collector_duration_seconds",
+}
+
+func allCollectors() []string {
+	var names []string
+	for name := range collectorRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exposition returns the text exposition of registry without the samples of
+// volatileMetrics
+func exposition(t *testing.T, registry *prometheus.Registry) string {
+	filename := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := prometheus.WriteToTextfile(filename, registry); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+lines:
+	for _, line := range strings.SplitAfter(string(out), "\n") {
+		for _, name := range volatileMetrics {
+			if strings.HasPrefix(line, name+"{") || strings.HasPrefix(line, name+" ") {
+				continue lines
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "")
+}
+
+// TestGolden replays every fixture in testdata/fixtures through all
+// collectors and compares the output to testdata/golden/<fixture>.prom,
+// run with -update to accept changes
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, dir := range fixtures {
+		dir := dir
+		name := filepath.Base(dir)
+		t.Run(name, func(t *testing.T) {
+			c, err := newNvmeCollector(nvme.Fixture{Dir: dir}, collectorOptions{
+				timeout:         time.Second,
+				concurrency:     1,
+				collectors:      allCollectors(),
+				selfTestResults: 5,
+				legacyNames:     true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(c)
+			got := exposition(t, registry)
+
+			golden := filepath.Join("testdata", "golden", name+".prom")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s, run go test -update to accept:\n%s", golden, diff(string(want), got))
+			}
+		})
+	}
+}
+
+// diff lists the lines only present in want (-) or got (+)
+func diff(want, got string) string {
+	count := map[string]int{}
+	for _, line := range strings.Split(want, "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(got, "\n") {
+		count[line]--
+	}
+	var out []string
+	for _, line := range strings.Split(want, "\n") {
+		if count[line] > 0 {
+			out = append(out, "- "+line)
+		}
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if count[line] < 0 {
+			out = append(out, "+ "+line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+// The privileged helper is a small process running as root which serves
+// the admin commands of a local backend over a Unix socket, so that the
+// process serving HTTP can run unprivileged with the helper backend.
+
+const helperService = "Helper"
+
+// HelperRequest holds the arguments of every helper call, net/rpc requires
+// exported types
+type HelperRequest struct {
+	Device string
+	Code   uint8
+	FID    uint8
+	CDW11  uint32
+}
+
+// HelperReply holds the result of every helper call, only the field of the
+// called method is set
+type HelperReply struct {
+	Devices     []nvme.Namespace
+	Controllers []nvme.ControllerDevice
+	SmartLog    *nvme.SmartLog
+	ErrorLog    []nvme.ErrorLogEntry
+	SelfTest    *nvme.SelfTestLog
+	Controller  *nvme.Controller
+	Namespace   *nvme.NamespaceInfo
+	Firmware    *nvme.FirmwareSlotLog
+	Fabrics     []nvme.FabricsController
+	Multipath   *nvme.Multipath
+	ANALog      *nvme.ANALog
+	Value       uint32
+}
+
+// Helper is the net/rpc service of the privileged helper
+type Helper struct {
+	backend nvme.Source
+	timeout time.Duration
+}
+
+func (h *Helper) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), h.timeout)
+}
+
+func (h *Helper) Devices(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Devices, err = h.backend.Namespaces(ctx)
+	return err
+}
+
+func (h *Helper) Controllers(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Controllers, err = h.backend.Controllers(ctx)
+	return err
+}
+
+func (h *Helper) SmartLog(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.SmartLog, err = h.backend.SmartLog(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) ErrorLog(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.ErrorLog, err = h.backend.ErrorLog(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) SelfTestLog(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.SelfTest, err = h.backend.SelfTestLog(ctx, req.Device)
+	return err
+}
+
+// StartSelfTest only starts short and extended self-tests, neither aborts
+// nor vendor specific ones
+func (h *Helper) StartSelfTest(req HelperRequest, reply *HelperReply) error {
+	if req.Code != nvme.SelfTestShort && req.Code != nvme.SelfTestExtended {
+		return fmt.Errorf("self-test code 0x%x is not allowed", req.Code)
+	}
+	ctx, cancel := h.context()
+	defer cancel()
+	return h.backend.StartSelfTest(ctx, req.Device, req.Code)
+}
+
+func (h *Helper) IdentifyController(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Controller, err = h.backend.IdentifyController(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) IdentifyNamespace(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Namespace, err = h.backend.IdentifyNamespace(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) FirmwareLog(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Firmware, err = h.backend.FirmwareLog(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) GetFeature(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Value, err = h.backend.GetFeature(ctx, req.Device, req.FID, req.CDW11)
+	return err
+}
+
+func (h *Helper) Paths(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Multipath, err = h.backend.Paths(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) ANALog(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.ANALog, err = h.backend.ANALog(ctx, req.Device)
+	return err
+}
+
+func (h *Helper) FabricsControllers(req HelperRequest, reply *HelperReply) (err error) {
+	ctx, cancel := h.context()
+	defer cancel()
+	reply.Fabrics, err = h.backend.FabricsControllers(ctx)
+	return err
+}
+
+// serveHelper serves b on the Unix socket at path until it fails. The socket
+// is only accessible by root and group, if set, and only the devices b lists
+// can be read.
+func serveHelper(b nvme.Source, path string, group string, timeout time.Duration) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chmod(path, 0660); err != nil {
+		return err
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.Atoi(g.Gid)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			return err
+		}
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName(helperService, &Helper{backend: newKnownDeviceBackend(b), timeout: timeout}); err != nil {
+		return err
+	}
+	log.Printf("Serving admin commands on %s\n", path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// helperBackend forwards every command to the privileged helper
+type helperBackend struct {
+	socket string
+}
+
+func (b helperBackend) call(ctx context.Context, method string, req HelperRequest) (*HelperReply, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", b.socket)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to helper: %s", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	var reply HelperReply
+	if err := client.Call(helperService+"."+method, req, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (b helperBackend) Namespaces(ctx context.Context) ([]nvme.Namespace, error) {
+	reply, err := b.call(ctx, "Devices", HelperRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Devices, nil
+}
+
+func (b helperBackend) Controllers(ctx context.Context) ([]nvme.ControllerDevice, error) {
+	reply, err := b.call(ctx, "Controllers", HelperRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Controllers, nil
+}
+
+func (b helperBackend) SmartLog(ctx context.Context, device string) (*nvme.SmartLog, error) {
+	reply, err := b.call(ctx, "SmartLog", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.SmartLog, nil
+}
+
+func (b helperBackend) ErrorLog(ctx context.Context, device string) ([]nvme.ErrorLogEntry, error) {
+	reply, err := b.call(ctx, "ErrorLog", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.ErrorLog, nil
+}
+
+func (b helperBackend) SelfTestLog(ctx context.Context, device string) (*nvme.SelfTestLog, error) {
+	reply, err := b.call(ctx, "SelfTestLog", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.SelfTest, nil
+}
+
+func (b helperBackend) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	_, err := b.call(ctx, "StartSelfTest", HelperRequest{Device: device, Code: code})
+	return err
+}
+
+func (b helperBackend) IdentifyController(ctx context.Context, device string) (*nvme.Controller, error) {
+	reply, err := b.call(ctx, "IdentifyController", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Controller, nil
+}
+
+func (b helperBackend) IdentifyNamespace(ctx context.Context, device string) (*nvme.NamespaceInfo, error) {
+	reply, err := b.call(ctx, "IdentifyNamespace", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Namespace, nil
+}
+
+func (b helperBackend) FirmwareLog(ctx context.Context, device string) (*nvme.FirmwareSlotLog, error) {
+	reply, err := b.call(ctx, "FirmwareLog", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Firmware, nil
+}
+
+func (b helperBackend) GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error) {
+	reply, err := b.call(ctx, "GetFeature", HelperRequest{Device: device, FID: fid, CDW11: cdw11})
+	if err != nil {
+		return 0, err
+	}
+	return reply.Value, nil
+}
+
+func (b helperBackend) Paths(ctx context.Context, device string) (*nvme.Multipath, error) {
+	reply, err := b.call(ctx, "Paths", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Multipath, nil
+}
+
+func (b helperBackend) ANALog(ctx context.Context, device string) (*nvme.ANALog, error) {
+	reply, err := b.call(ctx, "ANALog", HelperRequest{Device: device})
+	if err != nil {
+		return nil, err
+	}
+	return reply.ANALog, nil
+}
+
+func (b helperBackend) FabricsControllers(ctx context.Context) ([]nvme.FabricsController, error) {
+	reply, err := b.call(ctx, "FabricsControllers", HelperRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Fabrics, nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix creates the Unix socket at path with no permissions for others,
+// so that it is never accessible before its mode is set
+func listenUnix(path string) (net.Listener, error) {
+	umask := syscall.Umask(0117)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+func TestHelperStartSelfTest(t *testing.T) {
+	source := &selfTestSource{}
+	h := &Helper{backend: source, timeout: time.Second}
+
+	for _, code := range []uint8{nvme.SelfTestShort, nvme.SelfTestExtended} {
+		if err := h.StartSelfTest(HelperRequest{Device: "/dev/nvme0", Code: code}, &HelperReply{}); err != nil {
+			t.Errorf("code 0x%x: %s", code, err)
+		}
+	}
+	// abort and vendor specific
+	for _, code := range []uint8{0x0f, 0x0e, 0x03} {
+		if err := h.StartSelfTest(HelperRequest{Device: "/dev/nvme0", Code: code}, &HelperReply{}); err == nil {
+			t.Errorf("code 0x%x: got no error", code)
+		}
+	}
+	if want := []string{"/dev/nvme0", "/dev/nvme0"}; !reflect.DeepEqual(source.started, want) {
+		t.Errorf("got self-tests on %v, want %v", source.started, want)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+func init() {
+	registerCollector("identify", true, scopeController, newIdentifyCollector)
+}
+
+// identifyCollector exports the Identify Controller data structure
+type identifyCollector struct {
+	backend nvme.Source
+
+	nvmeControllerInfo                      *prometheus.Desc
+	nvmeTemperatureWarningThresholdCelsius  *prometheus.Desc
+	nvmeTemperatureCriticalThresholdCelsius *prometheus.Desc
+}
+
+func newIdentifyCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &identifyCollector{
+		backend: b,
+		nvmeControllerInfo: prometheus.NewDesc(
+			"nvme_controller_info",
+			"Identify Controller metadata of the controller, always 1.",
+			[]string{"controller", "subsystem", "model", "serial", "firmware_revision", "vendor_id", "subsystem_nqn", "controller_id", "pci_address", "transport"},
+			nil,
+		),
+		nvmeTemperatureWarningThresholdCelsius: prometheus.NewDesc(
+			"nvme_temperature_warning_threshold_celsius",
+			"Warning Composite Temperature Threshold (WCTEMP): the minimum Composite Temperature\n"+
+				"that indicates an overheating condition during which controller operation continues.\n"+
+				"Only present if the controller reports it.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		nvmeTemperatureCriticalThresholdCelsius: prometheus.NewDesc(
+			"nvme_temperature_critical_threshold_celsius",
+			"Critical Composite Temperature Threshold (CCTEMP): the minimum Composite Temperature\n"+
+				"that indicates a critical overheating condition (e.g., may prevent continued normal\n"+
+				"operation, possibility of data loss, automatic device shutdown, extreme performance\n"+
+				"throttling, or permanent damage). Only present if the controller reports it.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+	}
+}
+
+func (m *identifyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeControllerInfo
+	ch <- m.nvmeTemperatureWarningThresholdCelsius
+	ch <- m.nvmeTemperatureCriticalThresholdCelsius
+}
+
+func (m *identifyCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	info, err := m.backend.IdentifyController(ctx, controller.Path)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(m.nvmeControllerInfo, prometheus.GaugeValue, 1,
+		controller.Name, controller.Subsystem,
+		info.ModelNumber,
+		info.SerialNumber,
+		info.FirmwareRevision,
+		fmt.Sprintf("0x%04x", info.VendorID),
+		info.SubsystemNQN,
+		fmt.Sprint(info.ControllerID),
+		info.PCIAddress,
+		info.Transport,
+	)
+	if info.WarningTempThreshold != 0 {
+		ch <- prometheus.MustNewConstMetric(m.nvmeTemperatureWarningThresholdCelsius, prometheus.GaugeValue, kelvinToCelsius(float64(info.WarningTempThreshold)), controller.Name, controller.Subsystem)
+	}
+	if info.CriticalTempThreshold != 0 {
+		ch <- prometheus.MustNewConstMetric(m.nvmeTemperatureCriticalThresholdCelsius, prometheus.GaugeValue, kelvinToCelsius(float64(info.CriticalTempThreshold)), controller.Name, controller.Subsystem)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+func init() {
+	registerCollector("multipath", true, scopeController, newMultipathCollector)
+}
+
+// multipathCollector exports the ANA state of every native NVMe multipath path
+// through a controller, both as the kernel last saw it and as read from the
+// ANA log page of the controller
+type multipathCollector struct {
+	backend      nvme.Source
+	scrapeErrors *prometheus.CounterVec
+
+	nvmeMultipathIOPolicy *prometheus.Desc
+	nvmePathANAState      *prometheus.Desc
+	nvmePathANALogState   *prometheus.Desc
+
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+func newMultipathCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &multipathCollector{
+		backend:      b,
+		scrapeErrors: opts.scrapeErrors,
+		nvmeMultipathIOPolicy: prometheus.NewDesc(
+			"nvme_multipath_iopolicy",
+			"The I/O policy the kernel uses to select among the paths of the subsystem, always 1.",
+			[]string{"controller", "subsystem", "iopolicy"},
+			nil,
+		),
+		nvmePathANAState: prometheus.NewDesc(
+			"nvme_path_ana_state",
+			"Whether the path to the namespace through the controller is in the Asymmetric Namespace\n"+
+				"Access state (1) or not (0), as last read by the kernel, see ana_state in sysfs. I/O is\n"+
+				"only sent to optimized and non-optimized paths.",
+			[]string{"namespace", "controller", "state"},
+			nil,
+		),
+		nvmePathANALogState: prometheus.NewDesc(
+			"nvme_path_ana_log_state",
+			"Whether the path to the namespace through the controller is in the Asymmetric Namespace\n"+
+				"Access state (1) or not (0), as read from the ANA log page (Log Page 0Ch) of the controller\n"+
+				"during the scrape. Missing for controllers the log page can not be read from.",
+			[]string{"namespace", "controller", "state"},
+			nil,
+		),
+		failing: map[string]bool{},
+	}
+}
+
+func (m *multipathCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeMultipathIOPolicy
+	ch <- m.nvmePathANAState
+	ch <- m.nvmePathANALogState
+}
+
+// anaStates sends a 1 for the current state of the path and a 0 for the
+// other ANA states
+func anaStates(ch chan<- prometheus.Metric, desc *prometheus.Desc, namespace string, controller string, current string) {
+	known := false
+	for _, state := range nvme.ANAStates {
+		value := 0.0
+		if state == current {
+			value = 1
+			known = true
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, namespace, controller, state)
+	}
+	if !known {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, namespace, controller, current)
+	}
+}
+
+func (m *multipathCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	multipath, err := m.backend.Paths(ctx, controller.Path)
+	if err != nil {
+		return err
+	}
+	if len(multipath.Paths) == 0 {
+		return nil
+	}
+	if multipath.IOPolicy != "" {
+		ch <- prometheus.MustNewConstMetric(m.nvmeMultipathIOPolicy, prometheus.GaugeValue, 1, controller.Name, controller.Subsystem, multipath.IOPolicy)
+	}
+	ana := false
+	for _, path := range multipath.Paths {
+		if path.ANAState == "" {
+			continue
+		}
+		anaStates(ch, m.nvmePathANAState, path.Namespace, controller.Name, path.ANAState)
+		ana = true
+	}
+	if !ana {
+		return nil
+	}
+
+	// a path that lost its connection can not be read from, which must not
+	// hide the state the kernel reports for it
+	anaLog, err := m.backend.ANALog(ctx, controller.Path)
+	m.observe(controller.Path, err)
+	if err != nil {
+		return nil
+	}
+	for _, path := range multipath.Paths {
+		if path.ANAState == "" || path.NSID == 0 {
+			continue
+		}
+		if state := anaLog.State(path.NSID); state != "" {
+			anaStates(ch, m.nvmePathANALogState, path.Namespace, controller.Name, state)
+		}
+	}
+	return nil
+}
+
+// observe counts a failure to read the ANA log page of the controller and
+// logs when the controller starts or stops failing, not on every scrape
+func (m *multipathCollector) observe(device string, err error) {
+	if err != nil && m.scrapeErrors != nil {
+		m.scrapeErrors.WithLabelValues(device, "ana_log").Inc()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err != nil && !m.failing[device]:
+		log.Printf("%s\n", err)
+		m.failing[device] = true
+	case err == nil && m.failing[device]:
+		log.Printf("ana-log of device %s can be read again\n", device)
+		delete(m.failing, device)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+func init() {
+	registerCollector("namespace", true, scopeNamespace, newNamespaceCollector)
+}
+
+// namespaceCollector exports the Identify Namespace data structure
+type namespaceCollector struct {
+	backend nvme.Source
+
+	nvmeNamespaceInfo             *prometheus.Desc
+	nvmeNamespaceSizeBytes        *prometheus.Desc
+	nvmeNamespaceCapacityBytes    *prometheus.Desc
+	nvmeNamespaceUtilizationBytes *prometheus.Desc
+	nvmeNamespaceLBADataSizeBytes *prometheus.Desc
+	nvmeNamespaceMetadataBytes    *prometheus.Desc
+}
+
+func newNamespaceCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &namespaceCollector{
+		backend: b,
+		nvmeNamespaceInfo: prometheus.NewDesc(
+			"nvme_namespace_info",
+			"Identifiers of the namespace, always 1. The NGUID and EUI64 labels are empty if the\n"+
+				"namespace does not report them.",
+			[]string{"device", "nsid", "nguid", "eui64"},
+			nil,
+		),
+		nvmeNamespaceSizeBytes: prometheus.NewDesc(
+			"nvme_namespace_size_bytes",
+			"Namespace Size (NSZE): the total size of the namespace in bytes.",
+			[]string{"device"},
+			nil,
+		),
+		nvmeNamespaceCapacityBytes: prometheus.NewDesc(
+			"nvme_namespace_capacity_bytes",
+			"Namespace Capacity (NCAP): the maximum number of bytes that may be allocated in\n"+
+				"the namespace at any point in time. Smaller than the size for thin provisioned namespaces.",
+			[]string{"device"},
+			nil,
+		),
+		nvmeNamespaceUtilizationBytes: prometheus.NewDesc(
+			"nvme_namespace_utilization_bytes",
+			"Namespace Utilization (NUSE): the number of bytes currently allocated in the namespace.\n"+
+				"Deallocated blocks, e.g. after a trim, do not count towards the utilization.",
+			[]string{"device"},
+			nil,
+		),
+		nvmeNamespaceLBADataSizeBytes: prometheus.NewDesc(
+			"nvme_namespace_lba_data_size_bytes",
+			"LBA Data Size (LBADS): the logical block size of the LBA format the namespace is\n"+
+				"formatted with.",
+			[]string{"device"},
+			nil,
+		),
+		nvmeNamespaceMetadataBytes: prometheus.NewDesc(
+			"nvme_namespace_metadata_size_bytes",
+			"Metadata Size (MS): the number of metadata bytes per logical block of the LBA format\n"+
+				"the namespace is formatted with.",
+			[]string{"device"},
+			nil,
+		),
+	}
+}
+
+func (m *namespaceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeNamespaceInfo
+	ch <- m.nvmeNamespaceSizeBytes
+	ch <- m.nvmeNamespaceCapacityBytes
+	ch <- m.nvmeNamespaceUtilizationBytes
+	ch <- m.nvmeNamespaceLBADataSizeBytes
+	ch <- m.nvmeNamespaceMetadataBytes
+}
+
+func (m *namespaceCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	device := t.namespace
+	info, err := m.backend.IdentifyNamespace(ctx, device.Path)
+	if err != nil {
+		return err
+	}
+	blockSize := float64(info.LBADataSize)
+	ch <- prometheus.MustNewConstMetric(m.nvmeNamespaceInfo, prometheus.GaugeValue, 1,
+		device.Path, strconv.FormatUint(uint64(device.NSID), 10), info.NGUID, info.EUI64)
+	ch <- prometheus.MustNewConstMetric(m.nvmeNamespaceSizeBytes, prometheus.GaugeValue, float64(info.Size)*blockSize, device.Path)
+	ch <- prometheus.MustNewConstMetric(m.nvmeNamespaceCapacityBytes, prometheus.GaugeValue, float64(info.Capacity)*blockSize, device.Path)
+	ch <- prometheus.MustNewConstMetric(m.nvmeNamespaceUtilizationBytes, prometheus.GaugeValue, float64(info.Utilization)*blockSize, device.Path)
+	ch <- prometheus.MustNewConstMetric(m.nvmeNamespaceLBADataSizeBytes, prometheus.GaugeValue, blockSize, device.Path)
+	ch <- prometheus.MustNewConstMetric(m.nvmeNamespaceMetadataBytes, prometheus.GaugeValue, float64(info.MetadataSize), device.Path)
+	return nil
+}
@@ -0,0 +1,188 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	nvmeLogANA = 0x0c
+
+	// anaLogSize is read from the ANA log page, enough for 127 groups with
+	// one namespace each. Descriptors beyond it are dropped.
+	anaLogSize = 4096
+)
+
+// ANAStates are the names of the Asymmetric Namespace Access states as the
+// kernel reports them in sysfs
+var ANAStates = []string{"optimized", "non-optimized", "inaccessible", "persistent-loss", "change"}
+
+// anaStateName returns the name of an ANA state code, see Figure 209 of the
+// NVM Express Base Specification 2.0c
+func anaStateName(state uint8) string {
+	switch state {
+	case 0x01:
+		return "optimized"
+	case 0x02:
+		return "non-optimized"
+	case 0x03:
+		return "inaccessible"
+	case 0x04:
+		return "persistent-loss"
+	case 0x0f:
+		return "change"
+	}
+	return fmt.Sprintf("0x%02x", state)
+}
+
+// Multipath holds the native NVMe multipath paths through a controller
+type Multipath struct {
+	// IOPolicy is the iopolicy of the subsystem, e.g. numa or round-robin
+	IOPolicy string
+	Paths    []Path
+}
+
+// Path is the path to a namespace through the controller
+type Path struct {
+	// Namespace is the namespace device, e.g. /dev/nvme0n1
+	Namespace string
+	// NSID is the namespace identifier, 0 if unknown
+	NSID uint32
+	// ANAState is the state the kernel last read from the ANA log page,
+	// empty if the controller does not report ANA
+	ANAState string
+}
+
+// ANALog is the Asymmetric Namespace Access log page (Log Page 0Ch) of a
+// controller
+type ANALog struct {
+	ChangeCount uint64
+	Groups      []ANAGroup
+}
+
+// ANAGroup is an ANA Group Descriptor of the ANA log page
+type ANAGroup struct {
+	ID          uint32
+	ChangeCount uint64
+	State       string
+	NSIDs       []uint32
+}
+
+// State returns the state of the group of namespace nsid, empty if the log
+// does not list the namespace
+func (l *ANALog) State(nsid uint32) string {
+	for _, group := range l.Groups {
+		for _, id := range group.NSIDs {
+			if id == nsid {
+				return group.State
+			}
+		}
+	}
+	return ""
+}
+
+func (CLI) Paths(ctx context.Context, device string) (*Multipath, error) {
+	return defaultSysfs.paths(device), nil
+}
+
+func (Native) Paths(ctx context.Context, device string) (*Multipath, error) {
+	return defaultSysfs.paths(device), nil
+}
+
+// paths reads the paths through the controller device, a controller without
+// native multipath has none
+func (s sysfs) paths(device string) *Multipath {
+	controller := filepath.Base(device)
+	entries, _ := filepath.Glob(filepath.Join(string(s), "block", "*", "multipath", "*"))
+	sort.Strings(entries)
+	multipath := &Multipath{}
+	for _, entry := range entries {
+		parent, err := filepath.EvalSymlinks(filepath.Join(entry, "device"))
+		if err != nil || filepath.Base(parent) != controller {
+			continue
+		}
+		namespace := filepath.Base(filepath.Dir(filepath.Dir(entry)))
+		nsid, _ := strconv.ParseUint(s.attr("block", namespace, "nsid"), 10, 32)
+		multipath.Paths = append(multipath.Paths, Path{
+			Namespace: "/dev/" + namespace,
+			NSID:      uint32(nsid),
+			ANAState:  s.attr("block", filepath.Base(entry), "ana_state"),
+		})
+	}
+	if len(multipath.Paths) > 0 {
+		multipath.IOPolicy = s.attr("class", "nvme-subsystem", s.subsystem(controller), "iopolicy")
+	}
+	return multipath
+}
+
+func (CLI) ANALog(ctx context.Context, device string) (*ANALog, error) {
+	nvmeAnaLog, err := exec.CommandContext(ctx, "nvme", "ana-log", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme ana-log command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeAnaLog)) {
+		return nil, fmt.Errorf("nvmeAnaLog json is not valid for device: %s", device)
+	}
+	return parseANALogJSON(string(nvmeAnaLog)), nil
+}
+
+// parseANALogJSON handles the output of nvme ana-log, which names the
+// descriptor list with a trailing space
+func parseANALogJSON(nvmeAnaLog string) *ANALog {
+	log := &ANALog{ChangeCount: gjson.Get(nvmeAnaLog, "chgcnt").Uint()}
+	descriptors := gjson.Get(nvmeAnaLog, "ANA DESC LIST ")
+	if !descriptors.Exists() {
+		descriptors = gjson.Get(nvmeAnaLog, "ANA DESC LIST")
+	}
+	for _, desc := range descriptors.Array() {
+		group := ANAGroup{
+			ID:          uint32(desc.Get("grpid").Uint()),
+			ChangeCount: desc.Get("chgcnt").Uint(),
+			State:       desc.Get("state").String(),
+		}
+		for _, nsid := range desc.Get("NSIDS.#.nsid").Array() {
+			group.NSIDs = append(group.NSIDs, uint32(nsid.Uint()))
+		}
+		log.Groups = append(log.Groups, group)
+	}
+	return log
+}
+
+func (Native) ANALog(ctx context.Context, device string) (*ANALog, error) {
+	buf := make([]byte, anaLogSize)
+	if err := getLogPage(ctx, device, nvmeLogANA, nvmeNsidAll, buf); err != nil {
+		return nil, fmt.Errorf("error reading ana-log for device %s: %s", device, err)
+	}
+	return parseANALog(buf), nil
+}
+
+// parseANALog decodes the ANA log page, see Figures 207 and 208 of the NVM
+// Express Base Specification 2.0c
+func parseANALog(buf []byte) *ANALog {
+	le := binary.LittleEndian
+	log := &ANALog{ChangeCount: le.Uint64(buf[0:8])}
+	count := int(le.Uint16(buf[8:10]))
+	offset := 16
+	for i := 0; i < count && offset+32 <= len(buf); i++ {
+		desc := buf[offset:]
+		nnsids := int(le.Uint32(desc[4:8]))
+		group := ANAGroup{
+			ID:          le.Uint32(desc[0:4]),
+			ChangeCount: le.Uint64(desc[8:16]),
+			State:       anaStateName(desc[16] & 0xf),
+		}
+		for n := 0; n < nnsids && offset+32+n*4+4 <= len(buf); n++ {
+			group.NSIDs = append(group.NSIDs, le.Uint32(desc[32+n*4:]))
+		}
+		log.Groups = append(log.Groups, group)
+		offset += 32 + nnsids*4
+	}
+	return log
+}
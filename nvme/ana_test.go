@@ -0,0 +1,102 @@
+package nvme
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseANALog(t *testing.T) {
+	le := binary.LittleEndian
+	buf := make([]byte, anaLogSize)
+	le.PutUint64(buf[0:8], 7)
+	le.PutUint16(buf[8:10], 2)
+	// group 1 optimized with namespaces 1 and 2
+	desc := buf[16:]
+	le.PutUint32(desc[0:4], 1)
+	le.PutUint32(desc[4:8], 2)
+	le.PutUint64(desc[8:16], 5)
+	desc[16] = 0x01
+	le.PutUint32(desc[32:36], 1)
+	le.PutUint32(desc[36:40], 2)
+	// group 2 inaccessible with namespace 3
+	desc = buf[16+40:]
+	le.PutUint32(desc[0:4], 2)
+	le.PutUint32(desc[4:8], 1)
+	le.PutUint64(desc[8:16], 7)
+	desc[16] = 0x03
+	le.PutUint32(desc[32:36], 3)
+
+	want := &ANALog{ChangeCount: 7, Groups: []ANAGroup{
+		{ID: 1, ChangeCount: 5, State: "optimized", NSIDs: []uint32{1, 2}},
+		{ID: 2, ChangeCount: 7, State: "inaccessible", NSIDs: []uint32{3}},
+	}}
+	got := parseANALog(buf)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseANALog() = %+v, want %+v", got, want)
+	}
+	if state := got.State(3); state != "inaccessible" {
+		t.Errorf("State(3) = %q, want inaccessible", state)
+	}
+	if state := got.State(4); state != "" {
+		t.Errorf("State(4) = %q, want empty", state)
+	}
+}
+
+func TestParseANALogJSON(t *testing.T) {
+	log := parseANALogJSON(`{"Asymmetric Namespace Access Log for NVMe device":"nvme1","chgcnt":7,"ngrps":1,
+		"ANA DESC LIST ":[{"grpid":2,"nnsids":2,"chgcnt":7,"state":"non-optimized","NSIDS":[{"nsid":1},{"nsid":3}]}]}`)
+	want := &ANALog{ChangeCount: 7, Groups: []ANAGroup{
+		{ID: 2, ChangeCount: 7, State: "non-optimized", NSIDs: []uint32{1, 3}},
+	}}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("parseANALogJSON() = %+v, want %+v", log, want)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	s := fakeSysfs(t, map[string]string{
+		"class/nvme/nvme0":                        "",
+		"class/nvme/nvme1":                        "",
+		"class/nvme-subsystem/nvme-subsys0":       "",
+		"block/nvme0n1/device":                    "../../class/nvme-subsystem/nvme-subsys0",
+		"block/nvme0c0n1/device":                  "../../class/nvme/nvme0",
+		"block/nvme0c1n1/device":                  "../../class/nvme/nvme1",
+		"block/nvme0n1/multipath/nvme0c0n1":       "../../nvme0c0n1",
+		"block/nvme0n1/multipath/nvme0c1n1":       "../../nvme0c1n1",
+		"block/nvme0n2/device":                    "../../class/nvme-subsystem/nvme-subsys0",
+		"block/nvme0c1n2/device":                  "../../class/nvme/nvme1",
+		"block/nvme0n2/multipath/nvme0c1n2":       "../../nvme0c1n2",
+		"block/nvme2n1/device":                    "../../class/nvme/nvme2",
+		"class/nvme-subsystem/nvme-subsys0/nvme0": "../../nvme/nvme0",
+		"class/nvme-subsystem/nvme-subsys0/nvme1": "../../nvme/nvme1",
+	})
+	for path, value := range map[string]string{
+		"class/nvme-subsystem/nvme-subsys0/iopolicy": "numa\n",
+		"block/nvme0n1/nsid":                         "1\n",
+		"block/nvme0n2/nsid":                         "2\n",
+		"block/nvme0c0n1/ana_state":                  "optimized\n",
+		"block/nvme0c1n1/ana_state":                  "inaccessible\n",
+		"block/nvme0c1n2/ana_state":                  "optimized\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(string(s), path), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for device, want := range map[string]*Multipath{
+		"/dev/nvme0": {IOPolicy: "numa", Paths: []Path{
+			{Namespace: "/dev/nvme0n1", NSID: 1, ANAState: "optimized"},
+		}},
+		"/dev/nvme1": {IOPolicy: "numa", Paths: []Path{
+			{Namespace: "/dev/nvme0n1", NSID: 1, ANAState: "inaccessible"},
+			{Namespace: "/dev/nvme0n2", NSID: 2, ANAState: "optimized"},
+		}},
+		"/dev/nvme2": {},
+	} {
+		if got := s.paths(device); !reflect.DeepEqual(got, want) {
+			t.Errorf("paths(%s) = %+v, want %+v", device, got, want)
+		}
+	}
+}
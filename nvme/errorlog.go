@@ -0,0 +1,136 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+
+	"github.com/tidwall/gjson"
+)
+
+const errorLogEntrySize = 64
+
+// ErrorLogEntry is one entry of the Error Information log page (Log Page 01h).
+// The entry does not record the opcode of the failed command, only the
+// submission queue it was issued on.
+type ErrorLogEntry struct {
+	ErrorCount uint64
+	SQID       uint16
+	CmdID      uint16
+	// StatusField is the completion status without the phase tag,
+	// bits 7:0 are the status code and bits 10:8 the status code type
+	StatusField       uint16
+	ParmErrorLocation uint16
+	LBA               uint64
+	NSID              uint32
+}
+
+// StatusCode is the SC field of the completion status
+func (e ErrorLogEntry) StatusCode() uint16 {
+	return e.StatusField & 0xff
+}
+
+// StatusCodeType is the SCT field of the completion status
+func (e ErrorLogEntry) StatusCodeType() uint16 {
+	return (e.StatusField >> 8) & 0x7
+}
+
+// Queue is admin for commands on the admin submission queue (SQID 0),
+// io otherwise
+func (e ErrorLogEntry) Queue() string {
+	if e.SQID == 0 {
+		return "admin"
+	}
+	return "io"
+}
+
+var statusCodeTypes = map[uint16]string{
+	0: "generic",
+	1: "command_specific",
+	2: "media_data_integrity",
+	3: "path_related",
+	7: "vendor_specific",
+}
+
+// StatusCodeTypeName returns the metric label value of a status code type
+func StatusCodeTypeName(sct uint16) string {
+	if name, ok := statusCodeTypes[sct]; ok {
+		return name
+	}
+	return fmt.Sprintf("reserved_0x%x", sct)
+}
+
+func (CLI) ErrorLog(ctx context.Context, device string) ([]ErrorLogEntry, error) {
+	nvmeErrorLog, err := exec.CommandContext(ctx, "nvme", "error-log", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme error-log command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeErrorLog)) {
+		return nil, fmt.Errorf("nvmeErrorLog json is not valid for device: %s", device)
+	}
+	return parseErrorLogJSON(string(nvmeErrorLog)), nil
+}
+
+func parseErrorLogJSON(nvmeErrorLog string) []ErrorLogEntry {
+	entries := []ErrorLogEntry{}
+	gjson.Get(nvmeErrorLog, "errors").ForEach(func(_, e gjson.Result) bool {
+		entries = append(entries, ErrorLogEntry{
+			ErrorCount:        uint64(toFloat(e.Get("error_count"))),
+			SQID:              uint16(toFloat(e.Get("sqid"))),
+			CmdID:             uint16(toFloat(e.Get("cmdid"))),
+			StatusField:       uint16(toFloat(e.Get("status_field"))),
+			ParmErrorLocation: uint16(toFloat(e.Get("parm_error_location"))),
+			LBA:               uint64(toFloat(e.Get("lba"))),
+			NSID:              uint32(toFloat(e.Get("nsid"))),
+		})
+		return true
+	})
+	return entries
+}
+
+func (Native) ErrorLog(ctx context.Context, device string) ([]ErrorLogEntry, error) {
+	id, err := identifyController(ctx, device)
+	if err != nil {
+		return nil, fmt.Errorf("error identifying controller for device %s: %s", device, err)
+	}
+	// ELPE, Error Log Page Entries, is a 0's based value
+	elpe := int(id[262]) + 1
+	buf := make([]byte, elpe*errorLogEntrySize)
+	if err := getLogPage(ctx, device, nvmeLogError, nvmeNsidAll, buf); err != nil {
+		return nil, fmt.Errorf("error reading error-log for device %s: %s", device, err)
+	}
+	return parseErrorLog(buf), nil
+}
+
+// parseErrorLog decodes the Error Information log page, see Figure 206 of
+// the NVM Express Base Specification 2.0c
+func parseErrorLog(buf []byte) []ErrorLogEntry {
+	le := binary.LittleEndian
+	entries := make([]ErrorLogEntry, 0, len(buf)/errorLogEntrySize)
+	for off := 0; off+errorLogEntrySize <= len(buf); off += errorLogEntrySize {
+		e := buf[off : off+errorLogEntrySize]
+		entries = append(entries, ErrorLogEntry{
+			ErrorCount:        le.Uint64(e[0:8]),
+			SQID:              le.Uint16(e[8:10]),
+			CmdID:             le.Uint16(e[10:12]),
+			StatusField:       le.Uint16(e[12:14]) >> 1,
+			ParmErrorLocation: le.Uint16(e[14:16]),
+			LBA:               le.Uint64(e[16:24]),
+			NSID:              le.Uint32(e[24:28]),
+		})
+	}
+	return entries
+}
+
+// LatestErrorCount returns the highest error count in the log, entries
+// with an error count of 0 are unused
+func LatestErrorCount(entries []ErrorLogEntry) uint64 {
+	var latest uint64
+	for _, e := range entries {
+		if e.ErrorCount > latest {
+			latest = e.ErrorCount
+		}
+	}
+	return latest
+}
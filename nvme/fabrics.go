@@ -0,0 +1,81 @@
+package nvme
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// FabricsController is an NVMe over Fabrics controller, read from
+// /sys/class/nvme
+type FabricsController struct {
+	// Name and Subsystem are the sysfs names, e.g. nvme2 and nvme-subsys1
+	Name      string
+	Subsystem string
+	// Transport is tcp, rdma, fc or loop
+	Transport string
+	// TrAddr, TrSvcID and HostTrAddr are parsed from the address attribute
+	TrAddr       string
+	TrSvcID      string
+	HostTrAddr   string
+	HostNQN      string
+	SubsystemNQN string
+	// State is the controller state of the host driver, e.g. live or
+	// connecting
+	State string
+}
+
+func (CLI) FabricsControllers(ctx context.Context) ([]FabricsController, error) {
+	return defaultSysfs.fabricsControllers()
+}
+
+func (Native) FabricsControllers(ctx context.Context) ([]FabricsController, error) {
+	return defaultSysfs.fabricsControllers()
+}
+
+// fabricsControllers lists the controllers of a transport other than PCIe
+func (s sysfs) fabricsControllers() ([]FabricsController, error) {
+	entries, err := filepath.Glob(filepath.Join(string(s), "class", "nvme", "nvme*"))
+	if err != nil {
+		return nil, err
+	}
+	var controllers []FabricsController
+	for _, entry := range entries {
+		name := filepath.Base(entry)
+		transport := s.attr("class", "nvme", name, "transport")
+		if transport == "" || transport == "pcie" {
+			continue
+		}
+		controller := FabricsController{
+			Name:         name,
+			Subsystem:    s.subsystem(name),
+			Transport:    transport,
+			HostNQN:      s.attr("class", "nvme", name, "hostnqn"),
+			SubsystemNQN: s.attr("class", "nvme", name, "subsysnqn"),
+			State:        s.attr("class", "nvme", name, "state"),
+		}
+		address := parseFabricsAddress(s.attr("class", "nvme", name, "address"))
+		controller.TrAddr = address["traddr"]
+		controller.TrSvcID = address["trsvcid"]
+		controller.HostTrAddr = address["host_traddr"]
+		if controller.HostTrAddr == "" {
+			// the tcp transport reports the local address as src_addr
+			controller.HostTrAddr = address["src_addr"]
+		}
+		controllers = append(controllers, controller)
+	}
+	return controllers, nil
+}
+
+// parseFabricsAddress splits the address attribute of a fabrics controller,
+// e.g. traddr=192.168.1.10,trsvcid=4420,src_addr=192.168.1.2
+func parseFabricsAddress(address string) map[string]string {
+	fields := map[string]string{}
+	for _, field := range strings.Split(address, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) == 2 {
+			fields[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return fields
+}
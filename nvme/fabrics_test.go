@@ -0,0 +1,64 @@
+package nvme
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFabricsAddress(t *testing.T) {
+	for _, tc := range []struct {
+		address string
+		want    map[string]string
+	}{
+		{"traddr=192.168.1.10,trsvcid=4420,src_addr=192.168.1.2",
+			map[string]string{"traddr": "192.168.1.10", "trsvcid": "4420", "src_addr": "192.168.1.2"}},
+		{"traddr=nn-0x20000090fa942779:pn-0x10000090fa942779,host_traddr=nn-0x20000090fae0b5f5:pn-0x10000090fae0b5f5",
+			map[string]string{"traddr": "nn-0x20000090fa942779:pn-0x10000090fa942779", "host_traddr": "nn-0x20000090fae0b5f5:pn-0x10000090fae0b5f5"}},
+		{"", map[string]string{}},
+	} {
+		if got := parseFabricsAddress(tc.address); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseFabricsAddress(%q) = %v, want %v", tc.address, got, tc.want)
+		}
+	}
+}
+
+func TestFabricsControllers(t *testing.T) {
+	s := fakeSysfs(t, map[string]string{
+		"class/nvme/nvme0":                        "",
+		"class/nvme/nvme1":                        "",
+		"class/nvme-subsystem/nvme-subsys1":       "",
+		"class/nvme-subsystem/nvme-subsys1/nvme1": "../../nvme/nvme1",
+	})
+	for path, value := range map[string]string{
+		"class/nvme/nvme0/transport": "pcie\n",
+		"class/nvme/nvme0/address":   "0000:01:00.0\n",
+		"class/nvme/nvme1/transport": "rdma\n",
+		"class/nvme/nvme1/address":   "traddr=10.0.0.1,trsvcid=4420\n",
+		"class/nvme/nvme1/hostnqn":   "nqn.2014-08.org.nvmexpress:uuid:host\n",
+		"class/nvme/nvme1/subsysnqn": "nqn.2024-01.io.example:target\n",
+		"class/nvme/nvme1/state":     "resetting\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(string(s), path), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	controllers, err := s.fabricsControllers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FabricsController{{
+		Name:         "nvme1",
+		Subsystem:    "nvme-subsys1",
+		Transport:    "rdma",
+		TrAddr:       "10.0.0.1",
+		TrSvcID:      "4420",
+		HostNQN:      "nqn.2014-08.org.nvmexpress:uuid:host",
+		SubsystemNQN: "nqn.2024-01.io.example:target",
+		State:        "resetting",
+	}}
+	if !reflect.DeepEqual(controllers, want) {
+		t.Errorf("fabricsControllers() = %+v, want %+v", controllers, want)
+	}
+}
@@ -0,0 +1,82 @@
+package nvme
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+const (
+	nvmeAdminGetFeatures = 0x0a
+
+	nvmeFeatTemperatureThreshold = 0x04
+
+	// Threshold Type Select of the Temperature Threshold feature
+	thselOver  = 0x0
+	thselUnder = 0x1
+)
+
+var featureValueRegexp = regexp.MustCompile(`Current value:\s*(0x[0-9a-fA-F]+)`)
+
+func (CLI) GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error) {
+	out, err := exec.CommandContext(ctx, "nvme", "get-feature", device,
+		"-f", strconv.Itoa(int(fid)), "--cdw11="+strconv.FormatUint(uint64(cdw11), 10)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("error running nvme get-feature command for device %s: %s", device, err)
+	}
+	return parseFeatureValue(string(out), device)
+}
+
+// parseFeatureValue extracts dword 0 from the get-feature output, e.g.
+// "get-feature:0x04 (Temperature Threshold), Current value:0x00015e"
+func parseFeatureValue(out string, device string) (uint32, error) {
+	match := featureValueRegexp.FindStringSubmatch(out)
+	if match == nil {
+		return 0, fmt.Errorf("nvme get-feature output is not valid for device: %s", device)
+	}
+	value, err := strconv.ParseUint(match[1], 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("nvme get-feature output is not valid for device: %s: %s", device, err)
+	}
+	return uint32(value), nil
+}
+
+func (Native) GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error) {
+	cmd := nvmeAdminCmd{
+		opcode: nvmeAdminGetFeatures,
+		cdw10:  uint32(fid),
+		cdw11:  cdw11,
+	}
+	if err := adminPassthru(ctx, device, &cmd, nil); err != nil {
+		return 0, fmt.Errorf("error getting feature 0x%02x for device %s: %s", fid, device, err)
+	}
+	return cmd.result, nil
+}
+
+// TemperatureThresholds are the host configurable Temperature Threshold
+// feature (FID 04h) values of the composite temperature, in Kelvin
+type TemperatureThresholds struct {
+	Over  uint16
+	Under uint16
+}
+
+// ReadTemperatureThresholds reads the over and under thresholds of the
+// composite temperature from s
+func ReadTemperatureThresholds(ctx context.Context, s Source, device string) (*TemperatureThresholds, error) {
+	var thresholds TemperatureThresholds
+	for _, thsel := range []uint32{thselOver, thselUnder} {
+		// TMPSEL 0h selects the composite temperature
+		value, err := s.GetFeature(ctx, device, nvmeFeatTemperatureThreshold, thsel<<20)
+		if err != nil {
+			return nil, err
+		}
+		if thsel == thselOver {
+			thresholds.Over = uint16(value)
+		} else {
+			thresholds.Under = uint16(value)
+		}
+	}
+	return &thresholds, nil
+}
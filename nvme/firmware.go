@@ -0,0 +1,106 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	nvmeLogFirmwareSlot = 0x03
+
+	firmwareSlotLogSize = 512
+	firmwareSlotCount   = 7
+)
+
+// FirmwareSlotLog is the Firmware Slot Information log page (Log Page 03h)
+type FirmwareSlotLog struct {
+	// ActiveSlot is the slot of the currently running firmware, 1 to 7
+	ActiveSlot uint8
+	// PendingSlot is the slot activated at the next Controller Level Reset,
+	// 0 if none
+	PendingSlot uint8
+	// Revisions holds the firmware revision of slots 1 to 7, empty if the
+	// slot is unused
+	Revisions [firmwareSlotCount]string
+}
+
+// ActiveRevision returns the revision of the running firmware
+func (l *FirmwareSlotLog) ActiveRevision() string {
+	if l.ActiveSlot < 1 || int(l.ActiveSlot) > firmwareSlotCount {
+		return ""
+	}
+	return l.Revisions[l.ActiveSlot-1]
+}
+
+func (CLI) FirmwareLog(ctx context.Context, device string) (*FirmwareSlotLog, error) {
+	nvmeFwLog, err := exec.CommandContext(ctx, "nvme", "fw-log", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme fw-log command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeFwLog)) {
+		return nil, fmt.Errorf("nvmeFwLog json is not valid for device: %s", device)
+	}
+	return parseFirmwareLogJSON(string(nvmeFwLog)), nil
+}
+
+// firmwareRevisionRegexp matches the "<u64> (<revision>)" slot values of
+// nvme-cli 2.x
+var firmwareRevisionRegexp = regexp.MustCompile(`^[0-9]+ \((.*)\)$`)
+
+// parseFirmwareLogJSON handles the output of nvme-cli 1.x, which prints a
+// slot revision as the little endian u64 of its characters, and of nvme-cli
+// 2.x, which adds the characters in parentheses. Both nest the log in an
+// object named after the device.
+func parseFirmwareLogJSON(nvmeFwLog string) *FirmwareSlotLog {
+	var log gjson.Result
+	gjson.Parse(nvmeFwLog).ForEach(func(_, value gjson.Result) bool {
+		log = value
+		return false
+	})
+	afi := uint8(toFloat(log.Get("Active Firmware Slot (afi)")))
+	fw := &FirmwareSlotLog{
+		ActiveSlot:  afi & 0x7,
+		PendingSlot: (afi >> 4) & 0x7,
+	}
+	for i := range fw.Revisions {
+		slot := log.Get("Firmware Rev Slot " + strconv.Itoa(i+1))
+		if !slot.Exists() {
+			continue
+		}
+		if match := firmwareRevisionRegexp.FindStringSubmatch(slot.String()); match != nil {
+			fw.Revisions[i] = identifyString([]byte(match[1]))
+			continue
+		}
+		rev := make([]byte, 8)
+		binary.LittleEndian.PutUint64(rev, slot.Uint())
+		fw.Revisions[i] = identifyString(rev)
+	}
+	return fw
+}
+
+func (Native) FirmwareLog(ctx context.Context, device string) (*FirmwareSlotLog, error) {
+	buf := make([]byte, firmwareSlotLogSize)
+	if err := getLogPage(ctx, device, nvmeLogFirmwareSlot, nvmeNsidAll, buf); err != nil {
+		return nil, fmt.Errorf("error reading fw-log for device %s: %s", device, err)
+	}
+	return parseFirmwareLog(buf), nil
+}
+
+// parseFirmwareLog decodes the Firmware Slot Information log page, see
+// Figure 210 of the NVM Express Base Specification 2.0c
+func parseFirmwareLog(buf []byte) *FirmwareSlotLog {
+	fw := &FirmwareSlotLog{
+		ActiveSlot:  buf[0] & 0x7,
+		PendingSlot: (buf[0] >> 4) & 0x7,
+	}
+	for i := range fw.Revisions {
+		fw.Revisions[i] = identifyString(buf[8+i*8 : 16+i*8])
+	}
+	return fw
+}
@@ -0,0 +1,39 @@
+package nvme
+
+import "testing"
+
+func TestParseFirmwareLog(t *testing.T) {
+	buf := make([]byte, firmwareSlotLogSize)
+	// slot 1 active, slot 2 pending activation
+	buf[0] = 0x21
+	copy(buf[8:16], "VDV10184")
+	copy(buf[16:24], "E2MU200 ")
+
+	fw := parseFirmwareLog(buf)
+	if fw.ActiveSlot != 1 || fw.PendingSlot != 2 {
+		t.Errorf("got active slot %d, pending slot %d, want 1 and 2", fw.ActiveSlot, fw.PendingSlot)
+	}
+	want := [firmwareSlotCount]string{"VDV10184", "E2MU200"}
+	if fw.Revisions != want {
+		t.Errorf("got revisions %q, want %q", fw.Revisions, want)
+	}
+	if rev := fw.ActiveRevision(); rev != "VDV10184" {
+		t.Errorf("got active revision %q, want VDV10184", rev)
+	}
+}
+
+func TestParseFirmwareLogJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		json string
+	}{
+		{"nvme-cli 1.x", `{"nvme0n1":{"Active Firmware Slot (afi)":33,"Firmware Rev Slot 1":3762811571723977814,"Firmware Rev Slot 2":3763093046700688470}}`},
+		{"nvme-cli 2.x", `{"nvme0n1":{"Active Firmware Slot (afi)":33,"Firmware Rev Slot 1":"3762811571723977814 (VDV10184)","Firmware Rev Slot 2":"3763093046700688470 (VDV10194)"}}`},
+	} {
+		fw := parseFirmwareLogJSON(tc.json)
+		want := FirmwareSlotLog{ActiveSlot: 1, PendingSlot: 2, Revisions: [firmwareSlotCount]string{"VDV10184", "VDV10194"}}
+		if *fw != want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *fw, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package nvme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/tidwall/gjson"
+)
+
+// Fixture replays nvme-cli output recorded in Dir, so that the parsing can
+// be exercised without NVMe devices. Dir holds the output of nvme list in
+// list.json and a directory per controller and namespace, named after the
+// device, e.g.
+//
+//	list.json
+//	nvme0/smart-log.json
+//	nvme0/error-log.json
+//	nvme0/self-test-log.json
+//	nvme0/id-ctrl.json
+//	nvme0/fw-log.json
+//	nvme0/get-feature-04-00000000.txt
+//	nvme0/ana-log.json
+//	nvme0n1/id-ns.json
+//	sys/class/nvme/nvme0/model
+//	sys/block/nvme0n1/device -> ../../class/nvme/nvme0
+//
+// The get-feature files are named after the feature identifier and dword 11
+// in hex. A missing file fails the command like a failing nvme-cli would.
+// The sys directory is a fake sysfs tree that the controllers, the
+// topology and the controller attributes are read from.
+type Fixture struct {
+	Dir string
+}
+
+// read returns the recorded output of name for device, an empty device
+// reads from Dir itself
+func (f Fixture) read(device string, name string) (string, error) {
+	path := filepath.Join(f.Dir, filepath.Base(device), name)
+	if device == "" {
+		path = filepath.Join(f.Dir, name)
+	}
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading fixture: %s", err)
+	}
+	return string(out), nil
+}
+
+// sysfs returns the fake sysfs tree of the fixture
+func (f Fixture) sysfs() sysfs {
+	return sysfs(filepath.Join(f.Dir, "sys"))
+}
+
+// readJSON is read for recorded json output
+func (f Fixture) readJSON(device string, name string) (string, error) {
+	out, err := f.read(device, name)
+	if err != nil {
+		return "", err
+	}
+	if !gjson.Valid(out) {
+		return "", fmt.Errorf("fixture %s json is not valid for device: %s", name, device)
+	}
+	return out, nil
+}
+
+func (f Fixture) Namespaces(ctx context.Context) ([]Namespace, error) {
+	out, err := f.readJSON("", "list.json")
+	if err != nil {
+		return nil, err
+	}
+	namespaces := parseListJSON(out)
+	for idx := range namespaces {
+		namespaces[idx].NQN = f.sysfs().controllerAttr(namespaces[idx].Path, "subsysnqn")
+	}
+	f.sysfs().readTopology(namespaces)
+	return namespaces, nil
+}
+
+func (f Fixture) Controllers(ctx context.Context) ([]ControllerDevice, error) {
+	return f.sysfs().controllers()
+}
+
+func (f Fixture) SmartLog(ctx context.Context, device string) (*SmartLog, error) {
+	out, err := f.readJSON(device, "smart-log.json")
+	if err != nil {
+		return nil, err
+	}
+	return parseSmartLogJSON(out), nil
+}
+
+func (f Fixture) ErrorLog(ctx context.Context, device string) ([]ErrorLogEntry, error) {
+	out, err := f.readJSON(device, "error-log.json")
+	if err != nil {
+		return nil, err
+	}
+	return parseErrorLogJSON(out), nil
+}
+
+func (f Fixture) SelfTestLog(ctx context.Context, device string) (*SelfTestLog, error) {
+	out, err := f.readJSON(device, "self-test-log.json")
+	if err != nil {
+		return nil, err
+	}
+	return parseSelfTestLogJSON(out), nil
+}
+
+func (f Fixture) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	return fmt.Errorf("starting a self-test is not supported by fixtures")
+}
+
+func (f Fixture) IdentifyController(ctx context.Context, device string) (*Controller, error) {
+	out, err := f.readJSON(device, "id-ctrl.json")
+	if err != nil {
+		return nil, err
+	}
+	info := parseIdentifyControllerJSON(out)
+	f.sysfs().readController(info, device)
+	return info, nil
+}
+
+func (f Fixture) IdentifyNamespace(ctx context.Context, device string) (*NamespaceInfo, error) {
+	out, err := f.readJSON(device, "id-ns.json")
+	if err != nil {
+		return nil, err
+	}
+	return parseIdentifyNamespaceJSON(out), nil
+}
+
+func (f Fixture) FirmwareLog(ctx context.Context, device string) (*FirmwareSlotLog, error) {
+	out, err := f.readJSON(device, "fw-log.json")
+	if err != nil {
+		return nil, err
+	}
+	return parseFirmwareLogJSON(out), nil
+}
+
+func (f Fixture) Paths(ctx context.Context, device string) (*Multipath, error) {
+	return f.sysfs().paths(device), nil
+}
+
+func (f Fixture) ANALog(ctx context.Context, device string) (*ANALog, error) {
+	out, err := f.readJSON(device, "ana-log.json")
+	if err != nil {
+		return nil, err
+	}
+	return parseANALogJSON(out), nil
+}
+
+func (f Fixture) FabricsControllers(ctx context.Context) ([]FabricsController, error) {
+	return f.sysfs().fabricsControllers()
+}
+
+func (f Fixture) GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error) {
+	out, err := f.read(device, fmt.Sprintf("get-feature-%02x-%08x.txt", fid, cdw11))
+	if err != nil {
+		return 0, err
+	}
+	return parseFeatureValue(out, device)
+}
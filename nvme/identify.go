@@ -0,0 +1,89 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Controller holds a subset of the Identify Controller data structure, plus
+// the PCI address and transport from sysfs which Identify does not report
+type Controller struct {
+	VendorID         uint16
+	SerialNumber     string
+	ModelNumber      string
+	FirmwareRevision string
+	ControllerID     uint16
+	SubsystemNQN     string
+	// WarningTempThreshold and CriticalTempThreshold are WCTEMP and
+	// CCTEMP in Kelvin, 0 if not reported
+	WarningTempThreshold  uint16
+	CriticalTempThreshold uint16
+
+	PCIAddress string
+	Transport  string
+}
+
+func (CLI) IdentifyController(ctx context.Context, device string) (*Controller, error) {
+	nvmeIdCtrl, err := exec.CommandContext(ctx, "nvme", "id-ctrl", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme id-ctrl command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeIdCtrl)) {
+		return nil, fmt.Errorf("nvmeIdCtrl json is not valid for device: %s", device)
+	}
+	info := parseIdentifyControllerJSON(string(nvmeIdCtrl))
+	defaultSysfs.readController(info, device)
+	return info, nil
+}
+
+func parseIdentifyControllerJSON(nvmeIdCtrl string) *Controller {
+	m := gjson.GetMany(nvmeIdCtrl, "vid", "sn", "mn", "fr", "cntlid", "subnqn", "wctemp", "cctemp")
+	return &Controller{
+		VendorID:         uint16(toFloat(m[0])),
+		SerialNumber:     strings.TrimSpace(m[1].String()),
+		ModelNumber:      strings.TrimSpace(m[2].String()),
+		FirmwareRevision: strings.TrimSpace(m[3].String()),
+		ControllerID:     uint16(toFloat(m[4])),
+		SubsystemNQN:     strings.TrimSpace(m[5].String()),
+
+		WarningTempThreshold:  uint16(toFloat(m[6])),
+		CriticalTempThreshold: uint16(toFloat(m[7])),
+	}
+}
+
+func (Native) IdentifyController(ctx context.Context, device string) (*Controller, error) {
+	id, err := identifyController(ctx, device)
+	if err != nil {
+		return nil, fmt.Errorf("error identifying controller for device %s: %s", device, err)
+	}
+	info := parseIdentifyController(id)
+	defaultSysfs.readController(info, device)
+	return info, nil
+}
+
+// parseIdentifyController decodes the Identify Controller data structure,
+// see Figure 275 of the NVM Express Base Specification 2.0c
+func parseIdentifyController(buf []byte) *Controller {
+	le := binary.LittleEndian
+	return &Controller{
+		VendorID:         le.Uint16(buf[0:2]),
+		SerialNumber:     identifyString(buf[4:24]),
+		ModelNumber:      identifyString(buf[24:64]),
+		FirmwareRevision: identifyString(buf[64:72]),
+		ControllerID:     le.Uint16(buf[78:80]),
+		SubsystemNQN:     identifyString(buf[768:1024]),
+
+		WarningTempThreshold:  le.Uint16(buf[266:268]),
+		CriticalTempThreshold: le.Uint16(buf[268:270]),
+	}
+}
+
+// identifyString trims the space and NUL padding of identify ASCII fields
+func identifyString(b []byte) string {
+	return strings.TrimRight(string(b), " \x00")
+}
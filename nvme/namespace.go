@@ -0,0 +1,101 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// NamespaceInfo holds a subset of the Identify Namespace data structure
+type NamespaceInfo struct {
+	// Size, Capacity and Utilization are NSZE, NCAP and NUSE in logical
+	// blocks
+	Size        uint64
+	Capacity    uint64
+	Utilization uint64
+	// LBADataSize and MetadataSize are the sizes in bytes of the LBA format
+	// the namespace is formatted with
+	LBADataSize  uint64
+	MetadataSize uint16
+	// NGUID and EUI64 are hex encoded, empty if the namespace reports none
+	NGUID string
+	EUI64 string
+}
+
+func (CLI) IdentifyNamespace(ctx context.Context, device string) (*NamespaceInfo, error) {
+	nvmeIdNs, err := exec.CommandContext(ctx, "nvme", "id-ns", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme id-ns command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeIdNs)) {
+		return nil, fmt.Errorf("nvmeIdNs json is not valid for device: %s", device)
+	}
+	return parseIdentifyNamespaceJSON(string(nvmeIdNs)), nil
+}
+
+func parseIdentifyNamespaceJSON(nvmeIdNs string) *NamespaceInfo {
+	m := gjson.GetMany(nvmeIdNs, "nsze", "ncap", "nuse", "flbas", "nlbaf", "nguid", "eui64")
+	lbaf := gjson.Get(nvmeIdNs, "lbafs."+strconv.Itoa(lbaFormatIndex(uint8(toFloat(m[3])), uint8(toFloat(m[4])))))
+	return &NamespaceInfo{
+		Size:         uint64(toFloat(m[0])),
+		Capacity:     uint64(toFloat(m[1])),
+		Utilization:  uint64(toFloat(m[2])),
+		LBADataSize:  1 << uint(toFloat(lbaf.Get("ds"))),
+		MetadataSize: uint16(toFloat(lbaf.Get("ms"))),
+		NGUID:        identifier(strings.ToLower(m[5].String())),
+		EUI64:        identifier(strings.ToLower(m[6].String())),
+	}
+}
+
+func (Native) IdentifyNamespace(ctx context.Context, device string) (*NamespaceInfo, error) {
+	nsid, err := namespaceID(device)
+	if err != nil {
+		return nil, fmt.Errorf("error reading namespace id of device %s: %s", device, err)
+	}
+	id, err := identifyNamespace(ctx, device, nsid)
+	if err != nil {
+		return nil, fmt.Errorf("error identifying namespace for device %s: %s", device, err)
+	}
+	return parseIdentifyNamespace(id), nil
+}
+
+// parseIdentifyNamespace decodes the Identify Namespace data structure, see
+// Figure 97 of the NVM Command Set Specification 1.0c
+func parseIdentifyNamespace(buf []byte) *NamespaceInfo {
+	le := binary.LittleEndian
+	lbaf := buf[128+lbaFormatIndex(buf[26], buf[25])*4:]
+	return &NamespaceInfo{
+		Size:         le.Uint64(buf[0:8]),
+		Capacity:     le.Uint64(buf[8:16]),
+		Utilization:  le.Uint64(buf[16:24]),
+		LBADataSize:  1 << uint(lbaf[2]),
+		MetadataSize: le.Uint16(lbaf[0:2]),
+		NGUID:        identifier(hex.EncodeToString(buf[104:120])),
+		EUI64:        identifier(hex.EncodeToString(buf[120:128])),
+	}
+}
+
+// lbaFormatIndex returns the index of the formatted LBA format from FLBAS,
+// bits 6:5 extend the index if more than 16 formats are supported. nlbaf is
+// a 0's based value.
+func lbaFormatIndex(flbas uint8, nlbaf uint8) int {
+	index := int(flbas & 0xf)
+	if nlbaf >= 16 {
+		index |= int(flbas>>5&0x3) << 4
+	}
+	return index
+}
+
+// identifier returns hex encoded id, or empty if it is all zeros
+func identifier(id string) string {
+	if strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
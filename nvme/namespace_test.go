@@ -0,0 +1,55 @@
+package nvme
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseIdentifyNamespace(t *testing.T) {
+	buf := make([]byte, identifySize)
+	binary.LittleEndian.PutUint64(buf[0:8], 390703446)
+	binary.LittleEndian.PutUint64(buf[8:16], 2097152)
+	binary.LittleEndian.PutUint64(buf[16:24], 1187216)
+	// four LBA formats, formatted with the 4k one with 8 bytes of metadata
+	buf[25] = 3
+	buf[26] = 3
+	for idx, lbaf := range []struct {
+		ms    uint16
+		lbads uint8
+	}{{0, 9}, {8, 9}, {0, 12}, {8, 12}} {
+		binary.LittleEndian.PutUint16(buf[128+idx*4:], lbaf.ms)
+		buf[128+idx*4+2] = lbaf.lbads
+	}
+	copy(buf[120:128], []byte{0x00, 0x0a, 0x07, 0x52, 0x03, 0xac, 0x0f, 0xff})
+
+	want := NamespaceInfo{
+		Size:         390703446,
+		Capacity:     2097152,
+		Utilization:  1187216,
+		LBADataSize:  4096,
+		MetadataSize: 8,
+		EUI64:        "000a075203ac0fff",
+	}
+	if info := parseIdentifyNamespace(buf); *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+}
+
+func TestLBAFormatIndex(t *testing.T) {
+	for _, tc := range []struct {
+		flbas, nlbaf uint8
+		want         int
+	}{
+		{0x00, 0, 0},
+		{0x03, 3, 3},
+		// bit 4 is the metadata setting, not part of the index
+		{0x12, 3, 2},
+		// bits 6:5 are the upper bits with more than 16 formats
+		{0x21, 63, 17},
+		{0x21, 3, 1},
+	} {
+		if got := lbaFormatIndex(tc.flbas, tc.nlbaf); got != tc.want {
+			t.Errorf("lbaFormatIndex(0x%02x, %d) = %d, want %d", tc.flbas, tc.nlbaf, got, tc.want)
+		}
+	}
+}
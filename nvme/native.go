@@ -0,0 +1,106 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	nvmeAdminGetLogPage = 0x02
+	nvmeAdminIdentify   = 0x06
+
+	nvmeLogError = 0x01
+	nvmeLogSmart = 0x02
+
+	nvmeIdentifyCnsNamespace  = 0x00
+	nvmeIdentifyCnsController = 0x01
+	identifySize              = 4096
+
+	// broadcast namespace id, requests controller wide log pages
+	nvmeNsidAll = 0xffffffff
+)
+
+// nvmeAdminCmd mirrors struct nvme_admin_cmd from linux/nvme_ioctl.h
+type nvmeAdminCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// getLogPage issues a Get Log Page admin command and fills buf with the result
+func getLogPage(ctx context.Context, device string, lid uint8, nsid uint32, buf []byte) error {
+	numd := uint32(len(buf)/4 - 1)
+	cmd := nvmeAdminCmd{
+		opcode: nvmeAdminGetLogPage,
+		nsid:   nsid,
+		cdw10:  uint32(lid) | (numd&0xffff)<<16,
+		cdw11:  numd >> 16,
+	}
+	return adminPassthru(ctx, device, &cmd, buf)
+}
+
+// identifyController returns the 4096 byte Identify Controller data structure
+func identifyController(ctx context.Context, device string) ([]byte, error) {
+	buf := make([]byte, identifySize)
+	cmd := nvmeAdminCmd{
+		opcode: nvmeAdminIdentify,
+		cdw10:  nvmeIdentifyCnsController,
+	}
+	if err := adminPassthru(ctx, device, &cmd, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// identifyNamespace returns the 4096 byte Identify Namespace data structure
+// of namespace nsid
+func identifyNamespace(ctx context.Context, device string, nsid uint32) ([]byte, error) {
+	buf := make([]byte, identifySize)
+	cmd := nvmeAdminCmd{
+		opcode: nvmeAdminIdentify,
+		nsid:   nsid,
+		cdw10:  nvmeIdentifyCnsNamespace,
+	}
+	if err := adminPassthru(ctx, device, &cmd, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// commandTimeout converts the context deadline into the timeout_ms field of an
+// admin command, the kernel aborts the command once it expires
+func commandTimeout(ctx context.Context) uint32 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return uint32(ms)
+}
+
+// uint128 converts a 16 byte little endian counter to float64
+func uint128(b []byte) float64 {
+	lo := binary.LittleEndian.Uint64(b[0:8])
+	hi := binary.LittleEndian.Uint64(b[8:16])
+	return float64(hi)*math.Pow(2, 64) + float64(lo)
+}
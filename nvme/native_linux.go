@@ -0,0 +1,62 @@
+package nvme
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// _IO('N', 0x40)
+	nvmeIoctlID = 0x4e40
+	// _IOWR('N', 0x41, struct nvme_admin_cmd)
+	nvmeIoctlAdminCmd = 0xc0484e41
+)
+
+// adminPassthru submits cmd to device through NVME_IOCTL_ADMIN_CMD, buf is
+// used as the data buffer of the command
+func adminPassthru(ctx context.Context, device string, cmd *nvmeAdminCmd, buf []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(device, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(buf) > 0 {
+		cmd.addr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+		cmd.dataLen = uint32(len(buf))
+	}
+	cmd.timeoutMs = commandTimeout(ctx)
+
+	status, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(cmd)))
+	runtime.KeepAlive(buf)
+	if errno != 0 {
+		return errno
+	}
+	if status != 0 {
+		return fmt.Errorf("nvme status 0x%x", status)
+	}
+	return nil
+}
+
+// namespaceID returns the namespace id of the namespace device through
+// NVME_IOCTL_ID
+func namespaceID(device string) (uint32, error) {
+	f, err := os.OpenFile(device, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	nsid, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), nvmeIoctlID, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return uint32(nsid), nil
+}
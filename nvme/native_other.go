@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package nvme
+
+import (
+	"context"
+	"errors"
+)
+
+func adminPassthru(ctx context.Context, device string, cmd *nvmeAdminCmd, buf []byte) error {
+	return errors.New("native backend is only supported on linux")
+}
+
+func namespaceID(device string) (uint32, error) {
+	return 0, errors.New("native backend is only supported on linux")
+}
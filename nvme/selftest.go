@@ -0,0 +1,180 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	nvmeAdminDeviceSelfTest = 0x14
+
+	nvmeLogSelfTest = 0x06
+
+	selfTestLogSize     = 564
+	selfTestResultSize  = 28
+	selfTestResultCount = 20
+
+	// result code of an unused self-test result entry
+	selfTestResultUnused = 0xf
+)
+
+// Valid Diagnostic Information bits of a self-test result
+const (
+	SelfTestValidNSID = 1 << 0
+	SelfTestValidFLBA = 1 << 1
+)
+
+// Self-test codes of the Device Self-test command
+const (
+	SelfTestShort    = 0x1
+	SelfTestExtended = 0x2
+)
+
+// SelfTestLog is the Device Self-test log page (Log Page 06h)
+type SelfTestLog struct {
+	// CurrentOperation is 0h if no self-test is in progress, 1h short,
+	// 2h extended, Eh vendor specific
+	CurrentOperation  uint8
+	CurrentCompletion uint8
+	// Results are ordered newest first, unused entries are omitted
+	Results []SelfTestResult
+}
+
+// SelfTestResult is a Self-test Result Data Structure of the log page
+type SelfTestResult struct {
+	Result              uint8
+	Code                uint8
+	Segment             uint8
+	ValidDiagnosticInfo uint8
+	PowerOnHours        uint64
+	NSID                uint32
+	FailingLBA          uint64
+	StatusCodeType      uint8
+	StatusCode          uint8
+}
+
+var selfTestCodes = map[uint8]string{
+	0x0:              "none",
+	SelfTestShort:    "short",
+	SelfTestExtended: "extended",
+	0xe:              "vendor_specific",
+}
+
+// SelfTestCodeName returns the metric label value of a self-test code
+func SelfTestCodeName(code uint8) string {
+	if name, ok := selfTestCodes[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("reserved_0x%x", code)
+}
+
+func (CLI) SelfTestLog(ctx context.Context, device string) (*SelfTestLog, error) {
+	nvmeSelfTestLog, err := exec.CommandContext(ctx, "nvme", "self-test-log", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme self-test-log command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeSelfTestLog)) {
+		return nil, fmt.Errorf("nvmeSelfTestLog json is not valid for device: %s", device)
+	}
+	return parseSelfTestLogJSON(string(nvmeSelfTestLog)), nil
+}
+
+// parseSelfTestLogJSON handles both the "Self Test Result<n>" objects of
+// nvme-cli 1.x and the "List of Valid Reports" array of nvme-cli 2.x
+func parseSelfTestLogJSON(nvmeSelfTestLog string) *SelfTestLog {
+	selfTest := &SelfTestLog{
+		CurrentOperation:  uint8(toFloat(gjson.Get(nvmeSelfTestLog, "Current Device Self-Test Operation"))),
+		CurrentCompletion: uint8(toFloat(gjson.Get(nvmeSelfTestLog, "Current Device Self-Test Completion"))),
+	}
+	var results []gjson.Result
+	if reports := gjson.Get(nvmeSelfTestLog, "List of Valid Reports"); reports.Exists() {
+		results = reports.Array()
+	} else {
+		for i := 0; i < selfTestResultCount; i++ {
+			results = append(results, gjson.Get(nvmeSelfTestLog, "Self Test Result"+strconv.Itoa(i)))
+		}
+	}
+	for _, r := range results {
+		if !r.Exists() {
+			continue
+		}
+		result := SelfTestResult{
+			Result:              uint8(toFloat(r.Get("Self test result"))),
+			Code:                uint8(toFloat(r.Get("Self test code"))),
+			Segment:             uint8(toFloat(r.Get("Segment number"))),
+			ValidDiagnosticInfo: uint8(toFloat(r.Get("Valid Diagnostic Information"))),
+			PowerOnHours:        uint64(toFloat(r.Get("Power on hours"))),
+			NSID:                uint32(toFloat(r.Get("Namespace Identifier"))),
+			FailingLBA:          uint64(toFloat(r.Get("Failing LBA"))),
+			StatusCodeType:      uint8(toFloat(r.Get("Status Code Type"))),
+			StatusCode:          uint8(toFloat(r.Get("Status Code"))),
+		}
+		if result.Result == selfTestResultUnused {
+			continue
+		}
+		selfTest.Results = append(selfTest.Results, result)
+	}
+	return selfTest
+}
+
+func (Native) SelfTestLog(ctx context.Context, device string) (*SelfTestLog, error) {
+	buf := make([]byte, selfTestLogSize)
+	if err := getLogPage(ctx, device, nvmeLogSelfTest, nvmeNsidAll, buf); err != nil {
+		return nil, fmt.Errorf("error reading self-test-log for device %s: %s", device, err)
+	}
+	return parseSelfTestLog(buf), nil
+}
+
+// parseSelfTestLog decodes the Device Self-test log page, see Figures 213
+// and 214 of the NVM Express Base Specification 2.0c
+func parseSelfTestLog(buf []byte) *SelfTestLog {
+	le := binary.LittleEndian
+	selfTest := &SelfTestLog{
+		CurrentOperation:  buf[0] & 0xf,
+		CurrentCompletion: buf[1] & 0x7f,
+	}
+	for i := 0; i < selfTestResultCount; i++ {
+		r := buf[4+i*selfTestResultSize : 4+(i+1)*selfTestResultSize]
+		result := SelfTestResult{
+			Result:              r[0] & 0xf,
+			Code:                r[0] >> 4,
+			Segment:             r[1],
+			ValidDiagnosticInfo: r[2],
+			PowerOnHours:        le.Uint64(r[4:12]),
+			NSID:                le.Uint32(r[12:16]),
+			FailingLBA:          le.Uint64(r[16:24]),
+			StatusCodeType:      r[24] & 0x7,
+			StatusCode:          r[25],
+		}
+		if result.Result == selfTestResultUnused {
+			continue
+		}
+		selfTest.Results = append(selfTest.Results, result)
+	}
+	return selfTest
+}
+
+func (CLI) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	err := exec.CommandContext(ctx, "nvme", "device-self-test", device, "-s", strconv.Itoa(int(code))).Run()
+	if err != nil {
+		return fmt.Errorf("error running nvme device-self-test command for device %s: %s", device, err)
+	}
+	return nil
+}
+
+func (Native) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	cmd := nvmeAdminCmd{
+		opcode: nvmeAdminDeviceSelfTest,
+		nsid:   nvmeNsidAll,
+		cdw10:  uint32(code),
+	}
+	if err := adminPassthru(ctx, device, &cmd, nil); err != nil {
+		return fmt.Errorf("error starting self-test for device %s: %s", device, err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package nvme
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+)
+
+// SmartLog holds the decoded SMART / Health Information log page (Log Page 02h)
+type SmartLog struct {
+	CriticalWarning                    float64
+	Temperature                        float64
+	AvailSpare                         float64
+	SpareThresh                        float64
+	PercentUsed                        float64
+	EnduranceGrpCriticalWarningSummary float64
+	DataUnitsRead                      float64
+	DataUnitsWritten                   float64
+	HostReadCommands                   float64
+	HostWriteCommands                  float64
+	ControllerBusyTime                 float64
+	PowerCycles                        float64
+	PowerOnHours                       float64
+	UnsafeShutdowns                    float64
+	MediaErrors                        float64
+	NumErrLogEntries                   float64
+	WarningTempTime                    float64
+	CriticalCompTime                   float64
+	ThmTemp1TransCount                 float64
+	ThmTemp2TransCount                 float64
+	ThmTemp1TotalTime                  float64
+	ThmTemp2TotalTime                  float64
+	// TemperatureSensors are Temperature Sensor 1-8 in Kelvin, 0 if the
+	// sensor is not implemented
+	TemperatureSensors [8]float64
+}
+
+const smartLogSize = 512
+
+func (CLI) SmartLog(ctx context.Context, device string) (*SmartLog, error) {
+	nvmeSmartLog, err := exec.CommandContext(ctx, "nvme", "smart-log", device, "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme smart-log command for device %s: %s", device, err)
+	}
+	if !gjson.Valid(string(nvmeSmartLog)) {
+		return nil, fmt.Errorf("nvmeSmartLog json is not valid for device: %s", device)
+	}
+	return parseSmartLogJSON(string(nvmeSmartLog)), nil
+}
+
+func parseSmartLogJSON(nvmeSmartLog string) *SmartLog {
+	m := gjson.GetMany(nvmeSmartLog,
+		"critical_warning",
+		"temperature",
+		"avail_spare",
+		"spare_thresh",
+		"percent_used",
+		"endurance_grp_critical_warning_summary",
+		"data_units_read",
+		"data_units_written",
+		"host_read_commands",
+		"host_write_commands",
+		"controller_busy_time",
+		"power_cycles",
+		"power_on_hours",
+		"unsafe_shutdowns",
+		"media_errors",
+		"num_err_log_entries",
+		"warning_temp_time",
+		"critical_comp_time",
+		"thm_temp1_trans_count",
+		"thm_temp2_trans_count",
+		"thm_temp1_total_time",
+		"thm_temp2_total_time")
+
+	smart := &SmartLog{
+		CriticalWarning:                    toFloat(m[0]),
+		Temperature:                        toFloat(m[1]),
+		AvailSpare:                         toFloat(m[2]),
+		SpareThresh:                        toFloat(m[3]),
+		PercentUsed:                        toFloat(m[4]),
+		EnduranceGrpCriticalWarningSummary: toFloat(m[5]),
+		DataUnitsRead:                      toFloat(m[6]),
+		DataUnitsWritten:                   toFloat(m[7]),
+		HostReadCommands:                   toFloat(m[8]),
+		HostWriteCommands:                  toFloat(m[9]),
+		ControllerBusyTime:                 toFloat(m[10]),
+		PowerCycles:                        toFloat(m[11]),
+		PowerOnHours:                       toFloat(m[12]),
+		UnsafeShutdowns:                    toFloat(m[13]),
+		MediaErrors:                        toFloat(m[14]),
+		NumErrLogEntries:                   toFloat(m[15]),
+		WarningTempTime:                    toFloat(m[16]),
+		CriticalCompTime:                   toFloat(m[17]),
+		ThmTemp1TransCount:                 toFloat(m[18]),
+		ThmTemp2TransCount:                 toFloat(m[19]),
+		ThmTemp1TotalTime:                  toFloat(m[20]),
+		ThmTemp2TotalTime:                  toFloat(m[21]),
+	}
+	for i := range smart.TemperatureSensors {
+		smart.TemperatureSensors[i] = toFloat(gjson.Get(nvmeSmartLog, "temperature_sensor_"+strconv.Itoa(i+1)))
+	}
+	return smart
+}
+
+func (Native) SmartLog(ctx context.Context, device string) (*SmartLog, error) {
+	buf := make([]byte, smartLogSize)
+	if err := getLogPage(ctx, device, nvmeLogSmart, nvmeNsidAll, buf); err != nil {
+		return nil, fmt.Errorf("error reading smart-log for device %s: %s", device, err)
+	}
+	return parseSmartLog(buf), nil
+}
+
+// parseSmartLog decodes the SMART / Health Information log page, see
+// Figure 207 of the NVM Express Base Specification 2.0c
+func parseSmartLog(buf []byte) *SmartLog {
+	le := binary.LittleEndian
+	smart := &SmartLog{
+		CriticalWarning:                    float64(buf[0]),
+		Temperature:                        float64(le.Uint16(buf[1:3])),
+		AvailSpare:                         float64(buf[3]),
+		SpareThresh:                        float64(buf[4]),
+		PercentUsed:                        float64(buf[5]),
+		EnduranceGrpCriticalWarningSummary: float64(buf[6]),
+		DataUnitsRead:                      uint128(buf[32:48]),
+		DataUnitsWritten:                   uint128(buf[48:64]),
+		HostReadCommands:                   uint128(buf[64:80]),
+		HostWriteCommands:                  uint128(buf[80:96]),
+		ControllerBusyTime:                 uint128(buf[96:112]),
+		PowerCycles:                        uint128(buf[112:128]),
+		PowerOnHours:                       uint128(buf[128:144]),
+		UnsafeShutdowns:                    uint128(buf[144:160]),
+		MediaErrors:                        uint128(buf[160:176]),
+		NumErrLogEntries:                   uint128(buf[176:192]),
+		WarningTempTime:                    float64(le.Uint32(buf[192:196])),
+		CriticalCompTime:                   float64(le.Uint32(buf[196:200])),
+		ThmTemp1TransCount:                 float64(le.Uint32(buf[216:220])),
+		ThmTemp2TransCount:                 float64(le.Uint32(buf[220:224])),
+		ThmTemp1TotalTime:                  float64(le.Uint32(buf[224:228])),
+		ThmTemp2TotalTime:                  float64(le.Uint32(buf[228:232])),
+	}
+	for i := range smart.TemperatureSensors {
+		smart.TemperatureSensors[i] = float64(le.Uint16(buf[200+i*2 : 202+i*2]))
+	}
+	return smart
+}
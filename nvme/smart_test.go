@@ -0,0 +1,39 @@
+package nvme
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestParseSmartLog(t *testing.T) {
+	buf := make([]byte, smartLogSize)
+	buf[0] = 0x04
+	binary.LittleEndian.PutUint16(buf[1:3], 305)
+	buf[3] = 96
+	buf[5] = 23
+	// data units read above 2^64
+	binary.LittleEndian.PutUint64(buf[32:40], 7)
+	binary.LittleEndian.PutUint64(buf[40:48], 1)
+	binary.LittleEndian.PutUint64(buf[128:136], 31620)
+	binary.LittleEndian.PutUint16(buf[202:204], 316)
+
+	smart := parseSmartLog(buf)
+	for _, tc := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"CriticalWarning", smart.CriticalWarning, 4},
+		{"Temperature", smart.Temperature, 305},
+		{"AvailSpare", smart.AvailSpare, 96},
+		{"PercentUsed", smart.PercentUsed, 23},
+		{"DataUnitsRead", smart.DataUnitsRead, math.Pow(2, 64) + 7},
+		{"PowerOnHours", smart.PowerOnHours, 31620},
+		{"TemperatureSensors[0]", smart.TemperatureSensors[0], 0},
+		{"TemperatureSensors[1]", smart.TemperatureSensors[1], 316},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package nvme reads NVMe log pages and identify data, either through
+// nvme-cli or directly through the Linux admin passthrough ioctl.
+package nvme
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Namespace is a namespace block device, e.g. /dev/nvme0n1
+type Namespace struct {
+	Path   string
+	Model  string
+	Serial string
+	// NSID is the namespace identifier
+	NSID uint32
+	// NQN is the NVM subsystem NQN, read from sysfs
+	NQN string
+	// Controllers and Subsystem are the sysfs names of the controllers and
+	// NVM subsystem the namespace belongs to, e.g. nvme0 and nvme-subsys0.
+	// With native multipath there is a controller per path. Empty if
+	// unknown.
+	Controllers []string
+	Subsystem   string
+}
+
+// ControllerDevice is a controller character device, e.g. /dev/nvme0, read
+// from /sys/class/nvme
+type ControllerDevice struct {
+	Path string
+	// Name and Subsystem are the sysfs names, e.g. nvme0 and nvme-subsys0
+	Name      string
+	Subsystem string
+	Model     string
+	Serial    string
+	// NQN is the NVM subsystem NQN
+	NQN string
+}
+
+// Source discovers namespaces and controllers and reads their log pages.
+// Commands reading a controller log page, identify or feature take the
+// controller device path, the namespace ones the namespace device path.
+type Source interface {
+	Namespaces(ctx context.Context) ([]Namespace, error)
+	// Controllers lists the controller devices of the host
+	Controllers(ctx context.Context) ([]ControllerDevice, error)
+	SmartLog(ctx context.Context, device string) (*SmartLog, error)
+	ErrorLog(ctx context.Context, device string) ([]ErrorLogEntry, error)
+	SelfTestLog(ctx context.Context, device string) (*SelfTestLog, error)
+	StartSelfTest(ctx context.Context, device string, code uint8) error
+	IdentifyController(ctx context.Context, device string) (*Controller, error)
+	IdentifyNamespace(ctx context.Context, device string) (*NamespaceInfo, error)
+	FirmwareLog(ctx context.Context, device string) (*FirmwareSlotLog, error)
+	GetFeature(ctx context.Context, device string, fid uint8, cdw11 uint32) (uint32, error)
+	// Paths lists the native multipath paths through the controller device
+	Paths(ctx context.Context, device string) (*Multipath, error)
+	// ANALog takes a controller device, e.g. /dev/nvme1, as a namespace
+	// device would read the log page through any one of its paths
+	ANALog(ctx context.Context, device string) (*ANALog, error)
+	// FabricsControllers lists the NVMe over Fabrics controllers of the
+	// host, including those without a usable namespace
+	FabricsControllers(ctx context.Context) ([]FabricsController, error)
+}
+
+// CLI shells out to nvme-cli and parses its json output
+type CLI struct{}
+
+func (CLI) Namespaces(ctx context.Context) ([]Namespace, error) {
+	nvmeDeviceCmd, err := exec.CommandContext(ctx, "nvme", "list", "-o", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running nvme command: %s", err)
+	}
+	if !gjson.Valid(string(nvmeDeviceCmd)) {
+		return nil, fmt.Errorf("nvmeDeviceCmd json is not valid")
+	}
+	namespaces := parseListJSON(string(nvmeDeviceCmd))
+	for idx := range namespaces {
+		namespaces[idx].NQN = defaultSysfs.controllerAttr(namespaces[idx].Path, "subsysnqn")
+	}
+	defaultSysfs.readTopology(namespaces)
+	return namespaces, nil
+}
+
+func (CLI) Controllers(ctx context.Context) ([]ControllerDevice, error) {
+	return defaultSysfs.controllers()
+}
+
+func parseListJSON(nvmeDeviceCmd string) []Namespace {
+	nvmeDeviceList := gjson.Get(nvmeDeviceCmd, "Devices.#.DevicePath").Array()
+	nvmeModelList := gjson.Get(nvmeDeviceCmd, "Devices.#.ModelNumber").Array()
+	nvmeSerialList := gjson.Get(nvmeDeviceCmd, "Devices.#.SerialNumber").Array()
+	nvmeNamespaceList := gjson.Get(nvmeDeviceCmd, "Devices.#.NameSpace").Array()
+	namespaces := make([]Namespace, 0, len(nvmeDeviceList))
+	for idx, devicePath := range nvmeDeviceList {
+		namespace := Namespace{Path: devicePath.String()}
+		if idx < len(nvmeModelList) {
+			namespace.Model = nvmeModelList[idx].String()
+		}
+		if idx < len(nvmeSerialList) {
+			namespace.Serial = strings.TrimSpace(nvmeSerialList[idx].String())
+		}
+		if idx < len(nvmeNamespaceList) {
+			namespace.NSID = uint32(toFloat(nvmeNamespaceList[idx]))
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+// toFloat converts a json value to float64, nvme-cli prints some counters
+// as strings with thousands separators, e.g. "1,234,567"
+func toFloat(value gjson.Result) float64 {
+	if value.Type == gjson.String {
+		noCommas := strings.Replace(value.String(), ",", "", -1)
+		f, err := strconv.ParseFloat(noCommas, 64)
+		if err != nil {
+			return 0
+		}
+		return f
+	}
+
+	return value.Float()
+}
+
+var namespaceDeviceRegexp = regexp.MustCompile(`^nvme[0-9]+n[0-9]+$`)
+
+// Native talks to /dev/nvme* directly through NVME_IOCTL_ADMIN_CMD instead
+// of forking nvme-cli
+type Native struct{}
+
+func (Native) Namespaces(ctx context.Context) ([]Namespace, error) {
+	entries, err := filepath.Glob("/sys/block/nvme*")
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []Namespace
+	for _, entry := range entries {
+		name := filepath.Base(entry)
+		if !namespaceDeviceRegexp.MatchString(name) {
+			continue
+		}
+		model, err := ioutil.ReadFile(filepath.Join(entry, "device", "model"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading model for device %s: %s", name, err)
+		}
+		// nsid is missing on old kernels, NSID is left 0 then
+		nsidAttr, _ := ioutil.ReadFile(filepath.Join(entry, "nsid"))
+		nsid, _ := strconv.ParseUint(strings.TrimSpace(string(nsidAttr)), 10, 32)
+		path := "/dev/" + name
+		namespaces = append(namespaces, Namespace{
+			Path:   path,
+			Model:  strings.TrimSpace(string(model)),
+			Serial: defaultSysfs.controllerAttr(path, "serial"),
+			NSID:   uint32(nsid),
+			NQN:    defaultSysfs.controllerAttr(path, "subsysnqn"),
+		})
+	}
+	defaultSysfs.readTopology(namespaces)
+	return namespaces, nil
+}
+
+func (Native) Controllers(ctx context.Context) ([]ControllerDevice, error) {
+	return defaultSysfs.controllers()
+}
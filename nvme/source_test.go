@@ -0,0 +1,45 @@
+package nvme
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestToFloat(t *testing.T) {
+	for _, tc := range []struct {
+		json string
+		want float64
+	}{
+		{`1234567`, 1234567},
+		{`"1234567"`, 1234567},
+		{`"1,234,567"`, 1234567},
+		{`"41,327,700,148"`, 41327700148},
+		{`12.5`, 12.5},
+		{`"not a number"`, 0},
+		{`null`, 0},
+	} {
+		if got := toFloat(gjson.Parse(tc.json)); got != tc.want {
+			t.Errorf("toFloat(%s) = %v, want %v", tc.json, got, tc.want)
+		}
+	}
+}
+
+func TestParseListJSON(t *testing.T) {
+	namespaces := parseListJSON(`{"Devices":[
+		{"NameSpace":1,"DevicePath":"/dev/nvme0n1","ModelNumber":"INTEL SSDPE2KX040T8","SerialNumber":"PHLJ000000014P0DGN  "},
+		{"NameSpace":2,"DevicePath":"/dev/nvme0n2"}]}`)
+	want := []Namespace{
+		{Path: "/dev/nvme0n1", Model: "INTEL SSDPE2KX040T8", Serial: "PHLJ000000014P0DGN", NSID: 1},
+		{Path: "/dev/nvme0n2", NSID: 2},
+	}
+	if len(namespaces) != len(want) {
+		t.Fatalf("got %d namespaces, want %d", len(namespaces), len(want))
+	}
+	for idx := range want {
+		if !reflect.DeepEqual(namespaces[idx], want[idx]) {
+			t.Errorf("namespace %d = %+v, want %+v", idx, namespaces[idx], want[idx])
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package nvme
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sysfs is the directory sysfs is mounted on, fixtures carry a fake tree
+type sysfs string
+
+const defaultSysfs sysfs = "/sys"
+
+var controllerDeviceRegexp = regexp.MustCompile(`^nvme[0-9]+$`)
+
+// attr reads a sysfs attribute, missing attributes are returned empty
+func (s sysfs) attr(elem ...string) string {
+	value, err := ioutil.ReadFile(filepath.Join(append([]string{string(s)}, elem...)...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// topology returns the controllers, e.g. nvme0, and the subsystem, e.g.
+// nvme-subsys0, of the namespace device. With native multipath the device
+// of the namespace is its subsystem, the controllers of all paths are
+// returned then. Either is empty if it can not be resolved.
+func (s sysfs) topology(device string) (controllers []string, subsystem string) {
+	block := filepath.Join(string(s), "block", filepath.Base(device))
+	parent, err := filepath.EvalSymlinks(filepath.Join(block, "device"))
+	if err != nil {
+		return nil, ""
+	}
+	controller := filepath.Base(parent)
+	if strings.HasPrefix(controller, "nvme-subsys") {
+		paths, _ := filepath.Glob(filepath.Join(block, "multipath", "*"))
+		sort.Strings(paths)
+		for _, path := range paths {
+			if parent, err := filepath.EvalSymlinks(filepath.Join(path, "device")); err == nil {
+				controllers = append(controllers, filepath.Base(parent))
+			}
+		}
+		return controllers, controller
+	}
+	return []string{controller}, s.subsystem(controller)
+}
+
+// subsystem returns the NVM subsystem of controller, empty if unknown
+func (s sysfs) subsystem(controller string) string {
+	links, _ := filepath.Glob(filepath.Join(string(s), "class", "nvme-subsystem", "*", controller))
+	if len(links) == 0 {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(links[0]))
+}
+
+// controllerAttr reads a sysfs attribute of the controller device, or of
+// the first controller the namespace device belongs to, missing attributes
+// are returned empty
+func (s sysfs) controllerAttr(device string, attr string) string {
+	name := filepath.Base(device)
+	if controllerDeviceRegexp.MatchString(name) {
+		return s.attr("class", "nvme", name, attr)
+	}
+	if controllers, _ := s.topology(device); len(controllers) > 0 {
+		return s.attr("class", "nvme", controllers[0], attr)
+	}
+	return s.attr("block", name, "device", attr)
+}
+
+// controllers lists the controller devices in class/nvme
+func (s sysfs) controllers() ([]ControllerDevice, error) {
+	entries, err := filepath.Glob(filepath.Join(string(s), "class", "nvme", "nvme*"))
+	if err != nil {
+		return nil, err
+	}
+	var controllers []ControllerDevice
+	for _, entry := range entries {
+		name := filepath.Base(entry)
+		if !controllerDeviceRegexp.MatchString(name) {
+			continue
+		}
+		controllers = append(controllers, ControllerDevice{
+			Path:      "/dev/" + name,
+			Name:      name,
+			Subsystem: s.subsystem(name),
+			Model:     s.attr("class", "nvme", name, "model"),
+			Serial:    s.attr("class", "nvme", name, "serial"),
+			NQN:       s.attr("class", "nvme", name, "subsysnqn"),
+		})
+	}
+	return controllers, nil
+}
+
+// readController fills in the PCI address and transport of the controller
+// device. The address of fabrics controllers is left out, it is exported by
+// FabricsControllers.
+func (s sysfs) readController(info *Controller, device string) {
+	info.Transport = s.controllerAttr(device, "transport")
+	if info.Transport == "pcie" {
+		info.PCIAddress = s.controllerAttr(device, "address")
+	}
+}
+
+// readTopology fills in the controller and subsystem of the namespaces
+func (s sysfs) readTopology(namespaces []Namespace) {
+	for idx := range namespaces {
+		namespaces[idx].Controllers, namespaces[idx].Subsystem = s.topology(namespaces[idx].Path)
+	}
+}
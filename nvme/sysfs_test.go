@@ -0,0 +1,81 @@
+package nvme
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeSysfs creates the directories and symlinks of a sysfs tree below a
+// temporary directory, entries with a target are symlinks
+func fakeSysfs(t *testing.T, entries map[string]string) sysfs {
+	root := t.TempDir()
+	for path, target := range entries {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if target == "" {
+			err = os.MkdirAll(path, 0755)
+		} else {
+			err = os.Symlink(target, path)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sysfs(root)
+}
+
+func TestTopology(t *testing.T) {
+	s := fakeSysfs(t, map[string]string{
+		"class/nvme/nvme0":                        "",
+		"class/nvme/nvme1":                        "",
+		"class/nvme/nvme2":                        "",
+		"class/nvme-subsystem/nvme-subsys0":       "",
+		"class/nvme-subsystem/nvme-subsys0/nvme0": "../../nvme/nvme0",
+		"class/nvme-subsystem/nvme-subsys1":       "",
+		"class/nvme-subsystem/nvme-subsys1/nvme1": "../../nvme/nvme1",
+		"class/nvme-subsystem/nvme-subsys1/nvme2": "../../nvme/nvme2",
+		// a namespace of a controller without native multipath
+		"block/nvme0n1/device": "../../class/nvme/nvme0",
+		// a multipath head, its device is the subsystem
+		"block/nvme1n1/device":              "../../class/nvme-subsystem/nvme-subsys1",
+		"block/nvme1c2n1/device":            "../../class/nvme/nvme2",
+		"block/nvme1c1n1/device":            "../../class/nvme/nvme1",
+		"block/nvme1n1/multipath/nvme1c2n1": "../../nvme1c2n1",
+		"block/nvme1n1/multipath/nvme1c1n1": "../../nvme1c1n1",
+	})
+	for _, tc := range []struct {
+		device      string
+		controllers []string
+		subsystem   string
+	}{
+		{"/dev/nvme0n1", []string{"nvme0"}, "nvme-subsys0"},
+		{"/dev/nvme1n1", []string{"nvme1", "nvme2"}, "nvme-subsys1"},
+		{"/dev/nvme9n1", nil, ""},
+	} {
+		controllers, subsystem := s.topology(tc.device)
+		if !reflect.DeepEqual(controllers, tc.controllers) || subsystem != tc.subsystem {
+			t.Errorf("topology(%s) = %q, %q, want %q, %q", tc.device, controllers, subsystem, tc.controllers, tc.subsystem)
+		}
+	}
+
+	controllers, err := s.controllers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range controllers {
+		if c.Path != "/dev/"+c.Name {
+			t.Errorf("controller %s has path %s", c.Name, c.Path)
+		}
+		names = append(names, c.Name+" "+c.Subsystem)
+	}
+	want := []string{"nvme0 nvme-subsys0", "nvme1 nvme-subsys1", "nvme2 nvme-subsys1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("controllers() = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	defaultProbeModule = "default"
+
+	// probeCacheSize is the number of module and target collectors kept
+	// between probes, the least recently probed is dropped beyond it
+	probeCacheSize = 100
+)
+
+// probeModule configures how /probe reads a target's agent, it is selected
+// with the module parameter
+type probeModule struct {
+	// Scheme is http or https
+	Scheme     string        `yaml:"scheme"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Collectors []string      `yaml:"collectors"`
+	BasicAuth  struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	} `yaml:"basic_auth"`
+	TLSConfig probeTLSConfig `yaml:"tls_config"`
+	// Targets are regexps of the targets the module may probe, matched
+	// against the whole target
+	Targets regexpList `yaml:"targets"`
+	// AllowAnyTarget probes targets not matching Targets, too
+	AllowAnyTarget bool `yaml:"allow_any_target"`
+
+	targets []*regexp.Regexp
+}
+
+// allowed reports whether the module may probe target, no target is allowed
+// unless configured so that /probe is no proxy to arbitrary hosts
+func (m *probeModule) allowed(target string) bool {
+	return m.AllowAnyTarget || matchList(m.targets, target)
+}
+
+// probeHandler serves /probe?target=<host:port>&module=<name>, the metrics
+// of the agent at target labeled with target
+type probeHandler struct {
+	modules map[string]*probeModule
+	opts    collectorOptions
+
+	mu sync.Mutex
+	// collectors are kept per module and target so that state such as the
+	// scrape error counters survives between probes
+	collectors map[string]*probeEntry
+	// probes numbers the probes to find the least recently probed collector
+	probes uint64
+}
+
+type probeEntry struct {
+	collector *nvmeCollector
+	lastProbe uint64
+}
+
+// newProbeHandler fills in the unset module fields from opts, a default
+// module is added if not configured
+func newProbeHandler(modules map[string]*probeModule, opts collectorOptions) (*probeHandler, error) {
+	if modules == nil {
+		modules = map[string]*probeModule{}
+	}
+	if _, ok := modules[defaultProbeModule]; !ok {
+		modules[defaultProbeModule] = &probeModule{}
+	}
+	for name, module := range modules {
+		switch module.Scheme {
+		case "":
+			module.Scheme = "http"
+		case "http", "https":
+		default:
+			return nil, fmt.Errorf("module %s: unknown scheme %q", name, module.Scheme)
+		}
+		if module.Timeout == 0 {
+			module.Timeout = opts.timeout
+		}
+		if module.Collectors == nil {
+			module.Collectors = opts.collectors
+		}
+		for _, collector := range module.Collectors {
+			if _, ok := collectorRegistry[collector]; !ok {
+				return nil, fmt.Errorf("module %s: unknown collector %q", name, collector)
+			}
+		}
+		module.targets = nil
+		for _, expr := range module.Targets {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("module %s: invalid target regexp %q: %s", name, expr, err)
+			}
+			module.targets = append(module.targets, re)
+		}
+	}
+	return &probeHandler{modules: modules, opts: opts, collectors: map[string]*probeEntry{}}, nil
+}
+
+func (h *probeHandler) collector(target string, moduleName string, module *probeModule) (*nvmeCollector, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.probes++
+	key := moduleName + "/" + target
+	if e, ok := h.collectors[key]; ok {
+		e.lastProbe = h.probes
+		return e.collector, nil
+	}
+	b, err := newAgentBackend(target, module)
+	if err != nil {
+		return nil, err
+	}
+	opts := h.opts
+	opts.timeout = module.Timeout
+	opts.collectors = module.Collectors
+	// the state file is for the local drives, a probe keeps its state in
+	// memory
+	opts.firmwareStateFile = ""
+	c, err := newNvmeCollector(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.collectors) >= probeCacheSize {
+		h.evict()
+	}
+	h.collectors[key] = &probeEntry{collector: c, lastProbe: h.probes}
+	return c, nil
+}
+
+// evict drops the least recently probed collector
+func (h *probeHandler) evict() {
+	var oldest string
+	for key, e := range h.collectors {
+		if oldest == "" || e.lastProbe < h.collectors[oldest].lastProbe {
+			oldest = key
+		}
+	}
+	delete(h.collectors, oldest)
+}
+
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	if moduleName == "" {
+		moduleName = defaultProbeModule
+	}
+	module, ok := h.modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	if !module.allowed(target) {
+		http.Error(w, fmt.Sprintf("target %q is not allowed by module %q", target, moduleName), http.StatusForbidden)
+		return
+	}
+	c, err := h.collector(target, moduleName, module)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nvme_probe_success",
+		Help: "Whether the devices of the target could be listed (1) or not (0).",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nvme_probe_duration_seconds",
+		Help: "Time it took to probe the target.",
+	})
+	start := time.Now()
+	states, ok := c.scrape()
+	probeDuration.Set(time.Since(start).Seconds())
+	if ok {
+		probeSuccess.Set(1)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccess, probeDuration)
+	prometheus.WrapRegistererWith(prometheus.Labels{"target": target}, registry).MustRegister(&probeCollector{c, states})
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// probeCollector exports the outcome of a single probe
+type probeCollector struct {
+	*nvmeCollector
+	states []*deviceState
+}
+
+func (p *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	p.nvmeScrapeErrors.Collect(ch)
+	if p.states != nil {
+		p.collectStates(ch, p.states)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+// TestProbeHandler probes an agent serving a fixture on loopback
+func TestProbeHandler(t *testing.T) {
+	agent := httptest.NewServer(&agentHandler{
+		backend: newKnownDeviceBackend(nvme.Fixture{Dir: filepath.Join("testdata", "fixtures", "samsung-nvme-cli-1.9")}),
+		timeout: time.Second,
+	})
+	defer agent.Close()
+	target := agent.Listener.Addr().String()
+
+	h, err := newProbeHandler(map[string]*probeModule{
+		"agent": {Targets: regexpList{regexp.QuoteMeta(target)}},
+		"any":   {AllowAnyTarget: true},
+	}, collectorOptions{timeout: time.Second, concurrency: 1, collectors: allCollectors(), selfTestResults: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"target=" + target + "&module=agent", http.StatusOK},
+		{"target=other:9998&module=agent", http.StatusForbidden},
+		// the regexp must match the whole target
+		{"target=" + target + "0&module=agent", http.StatusForbidden},
+		// the default module allows no target
+		{"target=" + target, http.StatusForbidden},
+		{"target=" + target + "&module=any", http.StatusOK},
+		{"target=" + target + "&module=unknown", http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("GET", "/probe?"+tc.query, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: got status %d, want %d", tc.query, w.Code, tc.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/probe?target="+target+"&module=agent", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	body, err := ioutil.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"nvme_probe_success 1\n",
+		fmt.Sprintf(`nvme_scrape_device_success{device="/dev/nvme0",target=%q} 1`, target),
+		fmt.Sprintf(`nvme_available_spare_ratio{controller="nvme0",model="Samsung SSD 970 EVO Plus 1TB",subsystem="nvme-subsys0",target=%q} 1`, target),
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("probe output is missing %s", want)
+		}
+	}
+}
+
+func TestProbeHandlerInvalidTargetRegexp(t *testing.T) {
+	if _, err := newProbeHandler(map[string]*probeModule{"appliance": {Targets: regexpList{"("}}}, collectorOptions{}); err == nil {
+		t.Error("got no error for an invalid regexp")
+	}
+}
+func TestProbeHandlerCache(t *testing.T) {
+	h, err := newProbeHandler(nil, collectorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := h.modules[defaultProbeModule]
+	first, err := h.collector("host0:9998", defaultProbeModule, module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < probeCacheSize; i++ {
+		if _, err := h.collector(fmt.Sprintf("host%d:9998", i), defaultProbeModule, module); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// host0 is probed again, host1 becomes the least recently probed
+	if c, _ := h.collector("host0:9998", defaultProbeModule, module); c != first {
+		t.Error("host0 was not served from the cache")
+	}
+	if _, err := h.collector("new:9998", defaultProbeModule, module); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.collectors) != probeCacheSize {
+		t.Errorf("got %d cached collectors, want %d", len(h.collectors), probeCacheSize)
+	}
+	if _, ok := h.collectors[defaultProbeModule+"/host1:9998"]; ok {
+		t.Error("the least recently probed collector was not dropped")
+	}
+	if _, ok := h.collectors[defaultProbeModule+"/host0:9998"]; !ok {
+		t.Error("a recently probed collector was dropped")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+func init() {
+	registerCollector("self-test", true, scopeController, newSelfTestCollector)
+}
+
+// selfTestCollector exports the Device Self-test log page
+type selfTestCollector struct {
+	backend nvme.Source
+	results int
+
+	nvmeSelfTestCurrentOperation  *prometheus.Desc
+	nvmeSelfTestCurrentCompletion *prometheus.Desc
+	nvmeSelfTestResult            *prometheus.Desc
+	nvmeSelfTestPowerOnHours      *prometheus.Desc
+	nvmeSelfTestFailingLBA        *prometheus.Desc
+	nvmeSelfTestFailingNamespace  *prometheus.Desc
+}
+
+// newSelfTestCollector exports the newest opts.selfTestResults entries of
+// the self-test log
+func newSelfTestCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	resultLabels := []string{"controller", "subsystem", "index", "type"}
+	return &selfTestCollector{
+		backend: b,
+		results: opts.selfTestResults,
+		nvmeSelfTestCurrentOperation: prometheus.NewDesc(
+			"nvme_selftest_current_operation",
+			"Current Device Self-Test Operation: 0 no device self-test operation in progress,\n"+
+				"1 short device self-test operation in progress, 2 extended device self-test operation\n"+
+				"in progress, 14 vendor specific.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		nvmeSelfTestCurrentCompletion: prometheus.NewDesc(
+			"nvme_selftest_current_completion_percent",
+			"Current Device Self-Test Completion: percentage of the device self-test operation\n"+
+				"that is complete. Only valid while a device self-test operation is in progress.",
+			[]string{"controller", "subsystem"},
+			nil,
+		),
+		nvmeSelfTestResult: prometheus.NewDesc(
+			"nvme_selftest_result",
+			"Result of the device self-test operation, index 0 is the most recent.\n"+
+				"0 completed without error, 1 aborted by a Device Self-test command, 2 aborted by a\n"+
+				"Controller Level Reset, 3 aborted due to a removal of a namespace, 4 aborted due to\n"+
+				"the processing of a Format NVM command, 5 a fatal error or unknown test error occurred,\n"+
+				"6 completed with a segment that failed and the segment that failed is not known,\n"+
+				"7 completed with one or more failed segments, 8 aborted for unknown reason,\n"+
+				"9 aborted due to a sanitize operation.",
+			resultLabels,
+			nil,
+		),
+		nvmeSelfTestPowerOnHours: prometheus.NewDesc(
+			"nvme_selftest_power_on_hours",
+			"Power On Hours: the number of power-on hours at the time the device self-test\n"+
+				"operation was completed or aborted.",
+			resultLabels,
+			nil,
+		),
+		nvmeSelfTestFailingLBA: prometheus.NewDesc(
+			"nvme_selftest_failing_lba",
+			"Failing LBA: the LBA of the logical block that caused the test to fail.\n"+
+				"Only present if the controller reported it as valid.",
+			resultLabels,
+			nil,
+		),
+		nvmeSelfTestFailingNamespace: prometheus.NewDesc(
+			"nvme_selftest_failing_namespace",
+			"Namespace Identifier: the namespace that the Failing LBA occurred on.\n"+
+				"Only present if the controller reported it as valid.",
+			resultLabels,
+			nil,
+		),
+	}
+}
+
+func (m *selfTestCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nvmeSelfTestCurrentOperation
+	ch <- m.nvmeSelfTestCurrentCompletion
+	ch <- m.nvmeSelfTestResult
+	ch <- m.nvmeSelfTestPowerOnHours
+	ch <- m.nvmeSelfTestFailingLBA
+	ch <- m.nvmeSelfTestFailingNamespace
+}
+
+func (m *selfTestCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	selfTest, err := m.backend.SelfTestLog(ctx, controller.Path)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(m.nvmeSelfTestCurrentOperation, prometheus.GaugeValue, float64(selfTest.CurrentOperation), controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(m.nvmeSelfTestCurrentCompletion, prometheus.GaugeValue, float64(selfTest.CurrentCompletion), controller.Name, controller.Subsystem)
+	for idx, result := range selfTest.Results {
+		if idx >= m.results {
+			break
+		}
+		index := strconv.Itoa(idx)
+		testType := nvme.SelfTestCodeName(result.Code)
+		ch <- prometheus.MustNewConstMetric(m.nvmeSelfTestResult, prometheus.GaugeValue, float64(result.Result), controller.Name, controller.Subsystem, index, testType)
+		ch <- prometheus.MustNewConstMetric(m.nvmeSelfTestPowerOnHours, prometheus.GaugeValue, float64(result.PowerOnHours), controller.Name, controller.Subsystem, index, testType)
+		if result.ValidDiagnosticInfo&nvme.SelfTestValidFLBA != 0 {
+			ch <- prometheus.MustNewConstMetric(m.nvmeSelfTestFailingLBA, prometheus.GaugeValue, float64(result.FailingLBA), controller.Name, controller.Subsystem, index, testType)
+		}
+		if result.ValidDiagnosticInfo&nvme.SelfTestValidNSID != 0 {
+			ch <- prometheus.MustNewConstMetric(m.nvmeSelfTestFailingNamespace, prometheus.GaugeValue, float64(result.NSID), controller.Name, controller.Subsystem, index, testType)
+		}
+	}
+	return nil
+}
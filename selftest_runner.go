@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+
+	"nvme_exporter/nvme"
+)
+
+// selfTestSchedule starts a self-test on the controller of every namespace
+// device matching devices
+type selfTestSchedule struct {
+	// spec is the flag value, for logging
+	spec     string
+	code     uint8
+	schedule cron.Schedule
+	devices  *regexp.Regexp
+}
+
+// selfTestSchedules is a repeatable flag, each value has the form
+// <short|extended>;<cron spec>[;<device regexp>]
+type selfTestSchedules []selfTestSchedule
+
+func (s *selfTestSchedules) String() string {
+	return fmt.Sprintf("%d schedules", len(*s))
+}
+
+func (s *selfTestSchedules) Set(value string) error {
+	parts := strings.Split(value, ";")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("expected <short|extended>;<cron spec>[;<device regexp>], got %q", value)
+	}
+	schedule := selfTestSchedule{spec: value}
+	switch parts[0] {
+	case "short":
+		schedule.code = nvme.SelfTestShort
+	case "extended":
+		schedule.code = nvme.SelfTestExtended
+	default:
+		return fmt.Errorf("unknown self-test type %q", parts[0])
+	}
+	var err error
+	schedule.schedule, err = cron.ParseStandard(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid cron spec %q: %s", parts[1], err)
+	}
+	devices := ".*"
+	if len(parts) == 3 {
+		devices = parts[2]
+	}
+	schedule.devices, err = regexp.Compile(devices)
+	if err != nil {
+		return fmt.Errorf("invalid device regexp %q: %s", devices, err)
+	}
+	*s = append(*s, schedule)
+	return nil
+}
+
+type selfTestStart struct {
+	device   string
+	testType string
+}
+
+// selfTestRunner starts device self-tests on a schedule. Controllers are
+// tested one at a time across all schedules, the next controller is only
+// started once the previous self-test has finished. A schedule is skipped
+// while its previous run is still testing.
+type selfTestRunner struct {
+	backend      nvme.Source
+	timeout      time.Duration
+	pollInterval time.Duration
+	// maxDuration bounds the wait for a self-test to finish
+	maxDuration time.Duration
+	schedules   selfTestSchedules
+
+	// running is held while a device self-test is in progress
+	running sync.Mutex
+
+	mu      sync.Mutex
+	started map[selfTestStart]time.Time
+	// active holds the indexes of the schedules being run
+	active map[int]bool
+
+	nvmeSelfTestLastStartedTimestamp *prometheus.Desc
+}
+
+func newSelfTestRunner(b nvme.Source, schedules selfTestSchedules, timeout, pollInterval, maxDuration time.Duration) *selfTestRunner {
+	return &selfTestRunner{
+		backend:      b,
+		timeout:      timeout,
+		pollInterval: pollInterval,
+		maxDuration:  maxDuration,
+		schedules:    schedules,
+		started:      map[selfTestStart]time.Time{},
+		active:       map[int]bool{},
+		nvmeSelfTestLastStartedTimestamp: prometheus.NewDesc(
+			"nvme_selftest_last_started_timestamp_seconds",
+			"Unix time the exporter last started a device self-test.",
+			[]string{"device", "type"},
+			nil,
+		),
+	}
+}
+
+func (r *selfTestRunner) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.nvmeSelfTestLastStartedTimestamp
+}
+
+func (r *selfTestRunner) Collect(ch chan<- prometheus.Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for start, at := range r.started {
+		ch <- prometheus.MustNewConstMetric(r.nvmeSelfTestLastStartedTimestamp, prometheus.GaugeValue, float64(at.UnixNano())/1e9, start.device, start.testType)
+	}
+}
+
+func (r *selfTestRunner) start() {
+	c := cron.New()
+	for i := range r.schedules {
+		i := i
+		c.Schedule(r.schedules[i].schedule, cron.FuncJob(func() { r.run(i) }))
+	}
+	c.Start()
+}
+
+// run tests the controllers of schedule i unless its previous run is still
+// testing
+func (r *selfTestRunner) run(i int) {
+	schedule := r.schedules[i]
+	r.mu.Lock()
+	if r.active[i] {
+		r.mu.Unlock()
+		log.Printf("Skipping self-test schedule %q, its previous run has not finished\n", schedule.spec)
+		return
+	}
+	r.active[i] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.active, i)
+		r.mu.Unlock()
+	}()
+
+	devices, err := r.devices(schedule)
+	if err != nil {
+		log.Printf("Error listing nvme devices for self-test: %s\n", err)
+		return
+	}
+	for _, device := range devices {
+		r.testDevice(device, schedule.code)
+	}
+}
+
+// devices lists the controller devices to test for schedule, once per
+// controller even if several of its namespaces match. A namespace with
+// native multipath is tested through its first controller, a namespace with
+// unknown controllers through the namespace device.
+func (r *selfTestRunner) devices(schedule selfTestSchedule) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	namespaces, err := r.backend.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	controllers, err := r.backend.Controllers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	for _, controller := range controllers {
+		paths[controller.Name] = controller.Path
+	}
+	var devices []string
+	seen := map[string]bool{}
+	for _, namespace := range namespaces {
+		if !schedule.devices.MatchString(namespace.Path) {
+			continue
+		}
+		device := namespace.Path
+		if len(namespace.Controllers) > 0 && paths[namespace.Controllers[0]] != "" {
+			device = paths[namespace.Controllers[0]]
+		}
+		if !seen[device] {
+			seen[device] = true
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// testDevice starts a self-test on device and waits for it to finish, at
+// most maxDuration so that a controller never reporting completion does not
+// hold up the other controllers
+func (r *selfTestRunner) testDevice(device string, code uint8) {
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	inProgress, err := r.inProgress(device)
+	if err != nil {
+		log.Printf("%s\n", err)
+		return
+	}
+	if inProgress {
+		log.Printf("Not starting self-test on device %s, a self-test is already in progress\n", device)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	err = r.backend.StartSelfTest(ctx, device, code)
+	cancel()
+	if err != nil {
+		log.Printf("%s\n", err)
+		return
+	}
+	log.Printf("Started %s self-test on device %s\n", nvme.SelfTestCodeName(code), device)
+	r.mu.Lock()
+	r.started[selfTestStart{device, nvme.SelfTestCodeName(code)}] = time.Now()
+	r.mu.Unlock()
+
+	ctx, cancel = context.WithTimeout(context.Background(), r.maxDuration)
+	defer cancel()
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Self-test on device %s has not finished within %s, moving on\n", device, r.maxDuration)
+			return
+		case <-ticker.C:
+		}
+		inProgress, err := r.inProgress(device)
+		if err != nil {
+			log.Printf("%s\n", err)
+			return
+		}
+		if !inProgress {
+			return
+		}
+	}
+}
+
+func (r *selfTestRunner) inProgress(device string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	selfTest, err := r.backend.SelfTestLog(ctx, device)
+	if err != nil {
+		return false, err
+	}
+	return selfTest.CurrentOperation != 0, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"nvme_exporter/nvme"
+)
+
+// selfTestSource records the devices self-tests are started on, which finish
+// right away unless stuck
+type selfTestSource struct {
+	namespaceSource
+	stuck bool
+
+	mu      sync.Mutex
+	started []string
+}
+
+func (s *selfTestSource) StartSelfTest(ctx context.Context, device string, code uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = append(s.started, device)
+	return nil
+}
+
+func (s *selfTestSource) SelfTestLog(ctx context.Context, device string) (*nvme.SelfTestLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, started := range s.started {
+		if s.stuck && started == device {
+			return &nvme.SelfTestLog{CurrentOperation: nvme.SelfTestExtended}, nil
+		}
+	}
+	return &nvme.SelfTestLog{}, nil
+}
+
+func newTestSelfTestRunner(t *testing.T, source nvme.Source, flags ...string) *selfTestRunner {
+	var schedules selfTestSchedules
+	for _, flag := range flags {
+		if err := schedules.Set(flag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newSelfTestRunner(source, schedules, time.Second, time.Millisecond, 20*time.Millisecond)
+}
+
+func TestSelfTestRunnerControllers(t *testing.T) {
+	source := &selfTestSource{namespaceSource: namespaceSource{
+		namespaces: []nvme.Namespace{
+			{Path: "/dev/nvme0n1", Controllers: []string{"nvme0"}},
+			{Path: "/dev/nvme0n2", Controllers: []string{"nvme0"}},
+			{Path: "/dev/nvme1n1", Controllers: []string{"nvme1", "nvme2"}},
+			{Path: "/dev/nvme3n1"},
+			{Path: "/dev/nvme4n1", Controllers: []string{"nvme4"}},
+		},
+		controllers: []nvme.ControllerDevice{
+			{Path: "/dev/nvme0", Name: "nvme0"},
+			{Path: "/dev/nvme1", Name: "nvme1"},
+			{Path: "/dev/nvme2", Name: "nvme2"},
+			{Path: "/dev/nvme4", Name: "nvme4"},
+		},
+	}}
+	r := newTestSelfTestRunner(t, source, "short;@daily;nvme[0-3]")
+	r.run(0)
+
+	want := []string{"/dev/nvme0", "/dev/nvme1", "/dev/nvme3n1"}
+	if !reflect.DeepEqual(source.started, want) {
+		t.Errorf("got self-tests on %v, want %v", source.started, want)
+	}
+}
+
+func TestSelfTestRunnerSkipsActiveSchedule(t *testing.T) {
+	source := &selfTestSource{namespaceSource: namespaceSource{
+		namespaces:  []nvme.Namespace{{Path: "/dev/nvme0n1", Controllers: []string{"nvme0"}}},
+		controllers: []nvme.ControllerDevice{{Path: "/dev/nvme0", Name: "nvme0"}},
+	}}
+	r := newTestSelfTestRunner(t, source, "short;@daily", "extended;@weekly")
+	r.active[0] = true
+	r.run(0)
+	if len(source.started) != 0 {
+		t.Errorf("got self-tests on %v while the schedule was active", source.started)
+	}
+	r.run(1)
+	if want := []string{"/dev/nvme0"}; !reflect.DeepEqual(source.started, want) {
+		t.Errorf("got self-tests on %v, want %v", source.started, want)
+	}
+	if !r.active[0] || r.active[1] {
+		t.Errorf("got active schedules %v, want only 0", r.active)
+	}
+}
+
+func TestSelfTestRunnerStuckController(t *testing.T) {
+	source := &selfTestSource{stuck: true, namespaceSource: namespaceSource{
+		namespaces: []nvme.Namespace{
+			{Path: "/dev/nvme0n1", Controllers: []string{"nvme0"}},
+			{Path: "/dev/nvme1n1", Controllers: []string{"nvme1"}},
+		},
+		controllers: []nvme.ControllerDevice{{Path: "/dev/nvme0", Name: "nvme0"}, {Path: "/dev/nvme1", Name: "nvme1"}},
+	}}
+	r := newTestSelfTestRunner(t, source, "extended;@weekly")
+	done := make(chan struct{})
+	go func() {
+		r.run(0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the runner kept waiting for a stuck self-test")
+	}
+	if want := []string{"/dev/nvme0", "/dev/nvme1"}; !reflect.DeepEqual(source.started, want) {
+		t.Errorf("got self-tests on %v, want %v", source.started, want)
+	}
+}
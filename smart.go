@@ -0,0 +1,630 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"nvme_exporter/nvme"
+)
+
+var labels = []string{"model", "controller", "subsystem"}
+
+// criticalWarningBits names the bits of the Critical Warning field
+var criticalWarningBits = []struct {
+	bit  uint
+	name string
+}{
+	{0, "spare_below_threshold"},
+	{1, "temperature"},
+	{2, "reliability_degraded"},
+	{3, "read_only"},
+	{4, "volatile_backup_failed"},
+	{5, "pmr_read_only"},
+}
+
+// enduranceGrpCriticalWarningBits names the bits of the Endurance Group
+// Critical Warning Summary field
+var enduranceGrpCriticalWarningBits = []struct {
+	bit  uint
+	name string
+}{
+	{0, "spare_below_threshold"},
+	{2, "reliability_degraded"},
+	{3, "read_only"},
+}
+
+// a data unit is 1000 units of 512 bytes
+const dataUnitBytes = 512 * 1000
+
+func init() {
+	registerCollector("smart", true, scopeController, newSmartCollector)
+}
+
+// smartCollector exports the SMART / Health Information log page
+type smartCollector struct {
+	backend     nvme.Source
+	legacyNames bool
+
+	nvmeCriticalWarning                    *prometheus.Desc
+	nvmeTemperature                        *prometheus.Desc
+	nvmeAvailSpare                         *prometheus.Desc
+	nvmeSpareThresh                        *prometheus.Desc
+	nvmePercentUsed                        *prometheus.Desc
+	nvmeEnduranceGrpCriticalWarningSummary *prometheus.Desc
+	nvmeDataUnitsRead                      *prometheus.Desc
+	nvmeDataUnitsWritten                   *prometheus.Desc
+	nvmeHostReadCommands                   *prometheus.Desc
+	nvmeHostWriteCommands                  *prometheus.Desc
+	nvmeControllerBusyTime                 *prometheus.Desc
+	nvmePowerCycles                        *prometheus.Desc
+	nvmePowerOnHours                       *prometheus.Desc
+	nvmeUnsafeShutdowns                    *prometheus.Desc
+	nvmeMediaErrors                        *prometheus.Desc
+	nvmeNumErrLogEntries                   *prometheus.Desc
+	nvmeWarningTempTime                    *prometheus.Desc
+	nvmeCriticalCompTime                   *prometheus.Desc
+	nvmeThmTemp1TransCount                 *prometheus.Desc
+	nvmeThmTemp2TransCount                 *prometheus.Desc
+	nvmeThmTemp1TotalTime                  *prometheus.Desc
+	nvmeThmTemp2TotalTime                  *prometheus.Desc
+	nvmeTemperatureSensorCelsius           *prometheus.Desc
+	nvmeCriticalWarningBit                 *prometheus.Desc
+	nvmeEnduranceGrpCriticalWarningBit     *prometheus.Desc
+
+	nvmeTemperatureCelsius           *prometheus.Desc
+	nvmeAvailableSpareRatio          *prometheus.Desc
+	nvmeAvailableSpareThresholdRatio *prometheus.Desc
+	nvmePercentageUsedRatio          *prometheus.Desc
+	nvmeReadBytes                    *prometheus.Desc
+	nvmeWrittenBytes                 *prometheus.Desc
+	nvmeHostReadCommandsTotal        *prometheus.Desc
+	nvmeHostWriteCommandsTotal       *prometheus.Desc
+	nvmeControllerBusySeconds        *prometheus.Desc
+	nvmePowerCyclesTotal             *prometheus.Desc
+	nvmePowerOnSeconds               *prometheus.Desc
+	nvmeUnsafeShutdownsTotal         *prometheus.Desc
+	nvmeMediaErrorsTotal             *prometheus.Desc
+	nvmeNumErrLogEntriesTotal        *prometheus.Desc
+	nvmeWarningTemperatureSeconds    *prometheus.Desc
+	nvmeCriticalTemperatureSeconds   *prometheus.Desc
+	nvmeThermalMgmtTemp1Transitions  *prometheus.Desc
+	nvmeThermalMgmtTemp2Transitions  *prometheus.Desc
+	nvmeThermalMgmtTemp1Seconds      *prometheus.Desc
+	nvmeThermalMgmtTemp2Seconds      *prometheus.Desc
+}
+
+// nvme smart-log field descriptions can be found on page 181 of:
+// Figure 207: SMART / Health Information Log Page
+// https://nvmexpress.org/wp-content/uploads/NVM-Express-Base-Specification-2.0c-2022.10.04-Ratified.pdf
+
+func newSmartCollector(b nvme.Source, opts collectorOptions) deviceCollector {
+	return &smartCollector{
+		backend:     b,
+		legacyNames: opts.legacyNames,
+		nvmeCriticalWarning: prometheus.NewDesc(
+			"nvme_critical_warning",
+			"Critical Warning: This field indicates critical warnings for the state of the controller. Each bit\n"+
+				"corresponds to a critical warning type; multiple bits may be set. If a bit is cleared to ‘0’, then\n"+
+				"that critical warning does not apply. Critical warnings may result in an asynchronous event\n"+
+				"notification to the host. Bits in this field represent the current associated state and are not\n"+
+				"persistent. \n"+
+				"Bit Definition\n"+
+				"00 If set to ‘1’, then the available spare space has fallen below\nthe threshold.\n"+
+				"01 If set to ‘1’, then a temperature is above an over\n"+
+				"temperature threshold or below an under temperature\nthreshold (refer to section 5.14.1.4).\n"+
+				"02 If set to ‘1’, then the NVM subsystem reliability has been\n"+
+				"degraded due to significant media related errors or any\n"+
+				"internal error that degrades NVM subsystem reliability.\n"+
+				"03 If set to ‘1’, then the media has been placed in read only\nmode.\n"+
+				"04 If set to ‘1’, then the volatile memory backup device has\n"+
+				"failed. This field is only valid if the controller has a volatile\nmemory backup solution.\n"+
+				"07:05 Reserved",
+			labels,
+			nil,
+		),
+		nvmeTemperature: prometheus.NewDesc(
+			"nvme_temperature",
+			"Composite Temperature: Contains a value corresponding to a temperature in Kelvins that\n"+
+				"represents the current composite temperature of the controller and namespace(s) associated\n"+
+				"with that controller. The manner in which this value is computed is implementation specific\n"+
+				"and may not represent the actual temperature of any physical point in the NVM subsystem.\n"+
+				"The value of this field may be used to trigger an asynchronous event (refer to section 5.27.1.3).\n"+
+				"Warning and critical overheating composite temperature threshold values are reported by the\n"+
+				"WCTEMP and CCTEMP fields in the Identify Controller data structure in Figure 275. ",
+			labels,
+			nil,
+		),
+		nvmeAvailSpare: prometheus.NewDesc(
+			"nvme_avail_spare",
+			"Available Spare Threshold: When the Available Spare falls below the threshold indicated in\n"+
+				"this field, an asynchronous event completion may occur. The value is indicated as a\n"+
+				"normalized percentage (0% to 100%). The values 101 to 255 are reserved.",
+			labels,
+			nil,
+		),
+		nvmeSpareThresh: prometheus.NewDesc(
+			"nvme_spare_thresh",
+			"Available Spare Threshold: When the Available Spare falls below the threshold indicated in\n"+
+				"this field, an asynchronous event completion may occur. The value is indicated as a\n"+
+				"normalized percentage (0 to 100%).",
+			labels,
+			nil,
+		),
+		nvmePercentUsed: prometheus.NewDesc(
+			"nvme_percent_used",
+			"Percentage Used: Contains a vendor specific estimate of the percentage of NVM subsystem\n"+
+				"life used based on the actual usage and the manufacturer’s prediction of NVM life. A value of\n"+
+				"100 indicates that the estimated endurance of the NVM in the NVM subsystem has been\n"+
+				"consumed, but may not indicate an NVM subsystem failure. The value is allowed to exceed\n"+
+				"100. Percentages greater than 254 shall be represented as 255. This value shall be updated\n"+
+				"once per power-on hour (when the controller is not in a sleep state).\n"+
+				"Refer to the JEDEC JESD218A standard for SSD device life and endurance measurement\n"+
+				"techniques.",
+			labels,
+			nil,
+		),
+		nvmeEnduranceGrpCriticalWarningSummary: prometheus.NewDesc(
+			"nvme_endurance_grp_critical_warning_summary",
+			"Endurance Group Critical Warning Summary: This field indicates critical warnings for the\n"+
+				"state of Endurance Groups. Each bit corresponds to a critical warning type, multiple bits may\n"+
+				"be set to ‘1’. If a bit is cleared to ‘0’, then that critical warning does not apply to any Endurance\n"+
+				"Group. Critical warnings may result in an asynchronous event notification to the host. Bits in\n"+
+				"this field represent the current associated state and are not persistent.\n"+
+				"If a bit is set to ‘1’ in one or more Endurance Groups, then the corresponding bit shall be set\n"+
+				"to ‘1’ in this field.\n"+
+				"Bits Definition\n"+
+				"7:4 Reserved\n"+
+				"3 If set to ‘1’, then the namespaces in one or more Endurance Groups have been\n"+
+				"placed in read only mode not as a result of a change in the write protection state\n"+
+				"of a namespace (refer to section 8.12.1).\n"+
+				"2 If set to ‘1’, then the reliability of one or more Endurance Groups has been\n"+
+				"degraded due to significant media related errors or any internal error that\n"+
+				"degrades NVM subsystem reliability.\n"+
+				"1 Reserved\n"+
+				"0 If set to ‘1’, then the available spare capacity of one or more Endurance Groups\n"+
+				"has fallen below the threshold.",
+			labels,
+			nil,
+		),
+		nvmeDataUnitsRead: prometheus.NewDesc(
+			"nvme_data_units_read",
+			"Data Units Read: Contains the number of 512 byte data units the host has read from the\n"+
+				"controller; this value does not include metadata. This value is reported in thousands (i.e., a\n"+
+				"value of 1 corresponds to 1000 units of 512 bytes read) and is rounded up. When the LBA\n"+
+				"size is a value other than 512 bytes, the controller shall convert the amount of data read to\n"+
+				"512 byte units.\n"+
+				"For the NVM command set, logical blocks read as part of Compare and Read operations shall\n"+
+				"be included in this value.",
+			labels,
+			nil,
+		),
+		nvmeDataUnitsWritten: prometheus.NewDesc(
+			"nvme_data_units_written",
+			"Data Units Written: Contains the number of 512 byte data units the host has written to the\n"+
+				"controller; this value does not include metadata. This value is reported in thousands (i.e., a\n"+
+				"value of 1 corresponds to 1000 units of 512 bytes written) and is rounded up. When the LBA\n"+
+				"size is a value other than 512 bytes, the controller shall convert the amount of data written to\n"+
+				"512 byte units.\n"+
+				"For the NVM command set, logical blocks written as part of Write operations shall be included\n"+
+				"in this value. Write Uncorrectable commands shall not impact this value.",
+			labels,
+			nil,
+		),
+		nvmeHostReadCommands: prometheus.NewDesc(
+			"nvme_host_read_commands",
+			"Host Read Commands: Contains the number of read commands completed by the controller.\n"+
+				"For the NVM command set, this is the number of Compare and Read commands.",
+			labels,
+			nil,
+		),
+		nvmeHostWriteCommands: prometheus.NewDesc(
+			"nvme_host_write_commands",
+			"Host Write Commands: Contains the number of write commands completed by the\n"+
+				"controller.\n"+
+				"For the NVM command set, this is the number of Write commands.",
+			labels,
+			nil,
+		),
+		nvmeControllerBusyTime: prometheus.NewDesc(
+			"nvme_controller_busy_time",
+			"Controller Busy Time: Contains the amount of time the controller is busy with I/O commands.\n"+
+				"The controller is busy when there is a command outstanding to an I/O Queue (specifically, a\n"+
+				"command was issued via an I/O Submission Queue Tail doorbell write and the corresponding\n"+
+				"completion queue entry has not been posted yet to the associated I/O Completion Queue).\n"+
+				"This value is reported in minutes.",
+			labels,
+			nil,
+		),
+		nvmePowerCycles: prometheus.NewDesc(
+			"nvme_power_cycles",
+			"Power Cycles: Contains the number of power cycles.",
+			labels,
+			nil,
+		),
+		nvmePowerOnHours: prometheus.NewDesc(
+			"nvme_power_on_hours",
+			"Power On Hours: Contains the number of power-on hours. This may not include time that\n"+
+				"the controller was powered and in a non-operational power state.",
+			labels,
+			nil,
+		),
+		nvmeUnsafeShutdowns: prometheus.NewDesc(
+			"nvme_unsafe_shutdowns",
+			"Unsafe Shutdowns: Contains the number of unsafe shutdowns. This count is incremented\n"+
+				"when a shutdown notification (CC.SHN) is not received prior to loss of power.",
+			labels,
+			nil,
+		),
+		nvmeMediaErrors: prometheus.NewDesc(
+			"nvme_media_errors",
+			"Media and Data Integrity Errors: Contains the number of occurrences where the controller\n"+
+				"detected an unrecovered data integrity error. Errors such as uncorrectable ECC, CRC\n"+
+				"checksum failure, or LBA tag mismatch are included in this field.",
+			labels,
+			nil,
+		),
+		nvmeNumErrLogEntries: prometheus.NewDesc(
+			"nvme_num_err_log_entries",
+			"Number of Error Information Log Entries: Contains the number of Error Information log\n"+
+				"entries over the life of the controller.",
+			labels,
+			nil,
+		),
+		nvmeWarningTempTime: prometheus.NewDesc(
+			"nvme_warning_temp_time",
+			"Warning Composite Temperature Time: Contains the amount of time in minutes that the\n"+
+				"controller is operational and the Composite Temperature is greater than or equal to the\n"+
+				"Warning Composite Temperature Threshold (WCTEMP) field and less than the Critical\n"+
+				"Composite Temperature Threshold (CCTEMP) field in the Identify Controller data structure in\n"+
+				"Figure 90.\n"+
+				"If the value of the WCTEMP or CCTEMP field is 0h, then this field is always cleared to 0h\n"+
+				"regardless of the Composite Temperature value",
+			labels,
+			nil,
+		),
+		nvmeCriticalCompTime: prometheus.NewDesc(
+			"nvme_critical_comp_time",
+			"Critical Composite Temperature Time: Contains the amount of time in minutes that the\n"+
+				"controller is operational and the Composite Temperature is greater the Critical Composite\n"+
+				"Temperature Threshold (CCTEMP) field in the Identify Controller data structure in Figure 90.\n"+
+				"If the value of the CCTEMP field is 0h, then this field is always cleared to 0h regardless of the\n"+
+				"Composite Temperature value.",
+			labels,
+			nil,
+		),
+		nvmeThmTemp1TransCount: prometheus.NewDesc(
+			"nvme_thm_temp1_trans_count",
+			"Thermal Management Temperature 1 Transition Count: Contains the number of times the\n"+
+				"controller transitioned to lower power active power states or performed vendor specific thermal\n"+
+				"management actions while minimizing the impact on performance in order to attempt to\n"+
+				"reduce the Composite Temperature because of the host controlled thermal management\n"+
+				"feature (refer to section 8.15.5) (i.e., the Composite Temperature rose above the Thermal\n"+
+				"Management Temperature 1). This counter shall not wrap once the value FFFFFFFFh is\n"+
+				"reached. A value of 0h, indicates that this transition has never occurred or this field is not\n"+
+				"implemented. ",
+			labels,
+			nil,
+		),
+		nvmeThmTemp2TransCount: prometheus.NewDesc(
+			"nvme_thm_temp2_trans_count",
+			"Thermal Management Temperature 2 Transition Count: Contains the number of times the\n"+
+				"controller transitioned to lower power active power states or performed vendor specific thermal\n"+
+				"management actions regardless of the impact on performance (e.g., heavy throttling) in order\n"+
+				"to attempt to reduce the Composite Temperature because of the host controlled thermal\n"+
+				"management feature (refer to section 8.15.5) (i.e., the Composite Temperature rose above\n"+
+				"the Thermal Management Temperature 2). This counter shall not wrap once the value\n"+
+				"FFFFFFFFh is reached. A value of 0h, indicates that this transition has never occurred or this\n"+
+				"field is not implemented.",
+			labels,
+			nil,
+		),
+		nvmeThmTemp1TotalTime: prometheus.NewDesc(
+			"nvme_thm_temp1_trans_time",
+			"Total Time For Thermal Management Temperature 1: Contains the number of seconds that\n"+
+				"the controller had transitioned to lower power active power states or performed vendor specific\n"+
+				"thermal management actions while minimizing the impact on performance in order to attempt\n"+
+				"to reduce the Composite Temperature because of the host controlled thermal management\n"+
+				"feature (refer to section 8.15.5). This counter shall not wrap once the value FFFFFFFFh is\n"+
+				"reached. A value of 0h, indicates that this transition has never occurred or this field is not\n"+
+				"implemented.",
+			labels,
+			nil,
+		),
+		nvmeThmTemp2TotalTime: prometheus.NewDesc(
+			"nvme_thm_temp2_trans_time",
+			"Total Time For Thermal Management Temperature 2: Contains the number of seconds that\n"+
+				"the controller had transitioned to lower power active power states or performed vendor specific\n"+
+				"thermal management actions regardless of the impact on performance (e.g., heavy throttling)\n"+
+				"in order to attempt to reduce the Composite Temperature because of the host controlled\n"+
+				"thermal management feature (refer to section 8.15.5). This counter shall not wrap once the\n"+
+				"value FFFFFFFFh is reached. A value of 0h, indicates that this transition has never occurred\n"+
+				"or this field is not implemented.",
+			labels,
+			nil,
+		),
+		nvmeTemperatureSensorCelsius: prometheus.NewDesc(
+			"nvme_temperature_sensor_celsius",
+			"Temperature Sensor 1-8: Contains the current temperature reported by the temperature\n"+
+				"sensor, converted to degrees Celsius. Sensors the controller does not implement are omitted.",
+			append(labels, "sensor"),
+			nil,
+		),
+		nvmeCriticalWarningBit: prometheus.NewDesc(
+			"nvme_critical_warning_bit",
+			"Critical Warning decomposed into one series per bit, 1 if the warning is set:\n"+
+				"spare_below_threshold the available spare capacity has fallen below the threshold,\n"+
+				"temperature a temperature is above an over temperature threshold or below an under\n"+
+				"temperature threshold, reliability_degraded the NVM subsystem reliability has been degraded,\n"+
+				"read_only the media has been placed in read only mode, volatile_backup_failed the volatile\n"+
+				"memory backup device has failed, pmr_read_only the Persistent Memory Region has become read-only.",
+			append(labels, "type"),
+			nil,
+		),
+		nvmeEnduranceGrpCriticalWarningBit: prometheus.NewDesc(
+			"nvme_endurance_grp_critical_warning_summary_bit",
+			"Endurance Group Critical Warning Summary decomposed into one series per bit, 1 if the\n"+
+				"warning is set in one or more Endurance Groups: spare_below_threshold, reliability_degraded,\n"+
+				"read_only.",
+			append(labels, "type"),
+			nil,
+		),
+		nvmeTemperatureCelsius: prometheus.NewDesc(
+			"nvme_temperature_celsius",
+			"Composite Temperature: the current composite temperature of the controller and namespace(s)\n"+
+				"associated with that controller, converted from Kelvin to degrees Celsius. Omitted if the\n"+
+				"controller reports 0 Kelvin.",
+			labels,
+			nil,
+		),
+		nvmeAvailableSpareRatio: prometheus.NewDesc(
+			"nvme_available_spare_ratio",
+			"Available Spare: normalized ratio (0 to 1) of the remaining spare capacity available.",
+			labels,
+			nil,
+		),
+		nvmeAvailableSpareThresholdRatio: prometheus.NewDesc(
+			"nvme_available_spare_threshold_ratio",
+			"Available Spare Threshold: when the Available Spare falls below this ratio (0 to 1), an\n"+
+				"asynchronous event completion may occur.",
+			labels,
+			nil,
+		),
+		nvmePercentageUsedRatio: prometheus.NewDesc(
+			"nvme_percentage_used_ratio",
+			"Percentage Used: vendor specific estimate of the ratio of NVM subsystem life used. A value of 1\n"+
+				"indicates that the estimated endurance has been consumed. The value may exceed 1, values\n"+
+				"greater than 2.54 are represented as 2.55.",
+			labels,
+			nil,
+		),
+		nvmeReadBytes: prometheus.NewDesc(
+			"nvme_read_bytes_total",
+			"Data Units Read converted to bytes: the amount of data the host has read from the controller,\n"+
+				"excluding metadata. The controller rounds up to units of 512000 bytes.",
+			labels,
+			nil,
+		),
+		nvmeWrittenBytes: prometheus.NewDesc(
+			"nvme_written_bytes_total",
+			"Data Units Written converted to bytes: the amount of data the host has written to the controller,\n"+
+				"excluding metadata. The controller rounds up to units of 512000 bytes.",
+			labels,
+			nil,
+		),
+		nvmeHostReadCommandsTotal: prometheus.NewDesc(
+			"nvme_host_read_commands_total",
+			"Host Read Commands: the number of read commands completed by the controller.",
+			labels,
+			nil,
+		),
+		nvmeHostWriteCommandsTotal: prometheus.NewDesc(
+			"nvme_host_write_commands_total",
+			"Host Write Commands: the number of write commands completed by the controller.",
+			labels,
+			nil,
+		),
+		nvmeControllerBusySeconds: prometheus.NewDesc(
+			"nvme_controller_busy_seconds_total",
+			"Controller Busy Time converted to seconds: the amount of time the controller is busy with I/O commands.",
+			labels,
+			nil,
+		),
+		nvmePowerCyclesTotal: prometheus.NewDesc(
+			"nvme_power_cycles_total",
+			"Power Cycles: the number of power cycles.",
+			labels,
+			nil,
+		),
+		nvmePowerOnSeconds: prometheus.NewDesc(
+			"nvme_power_on_seconds_total",
+			"Power On Hours converted to seconds. This may not include time that the controller was\n"+
+				"powered and in a non-operational power state.",
+			labels,
+			nil,
+		),
+		nvmeUnsafeShutdownsTotal: prometheus.NewDesc(
+			"nvme_unsafe_shutdowns_total",
+			"Unsafe Shutdowns: the number of unsafe shutdowns.",
+			labels,
+			nil,
+		),
+		nvmeMediaErrorsTotal: prometheus.NewDesc(
+			"nvme_media_errors_total",
+			"Media and Data Integrity Errors: the number of occurrences where the controller detected an\n"+
+				"unrecovered data integrity error.",
+			labels,
+			nil,
+		),
+		nvmeNumErrLogEntriesTotal: prometheus.NewDesc(
+			"nvme_num_err_log_entries_total",
+			"Number of Error Information Log Entries over the life of the controller.",
+			labels,
+			nil,
+		),
+		nvmeWarningTemperatureSeconds: prometheus.NewDesc(
+			"nvme_warning_temperature_seconds_total",
+			"Warning Composite Temperature Time converted to seconds: the amount of time the Composite\n"+
+				"Temperature is greater than or equal to WCTEMP and less than CCTEMP.",
+			labels,
+			nil,
+		),
+		nvmeCriticalTemperatureSeconds: prometheus.NewDesc(
+			"nvme_critical_temperature_seconds_total",
+			"Critical Composite Temperature Time converted to seconds: the amount of time the Composite\n"+
+				"Temperature is greater than or equal to CCTEMP.",
+			labels,
+			nil,
+		),
+		nvmeThermalMgmtTemp1Transitions: prometheus.NewDesc(
+			"nvme_thermal_mgmt_temp1_transitions_total",
+			"Thermal Management Temperature 1 Transition Count: the number of times the controller\n"+
+				"throttled while minimizing the impact on performance because the Composite Temperature\n"+
+				"rose above the Thermal Management Temperature 1.",
+			labels,
+			nil,
+		),
+		nvmeThermalMgmtTemp2Transitions: prometheus.NewDesc(
+			"nvme_thermal_mgmt_temp2_transitions_total",
+			"Thermal Management Temperature 2 Transition Count: the number of times the controller\n"+
+				"throttled regardless of the impact on performance because the Composite Temperature\n"+
+				"rose above the Thermal Management Temperature 2.",
+			labels,
+			nil,
+		),
+		nvmeThermalMgmtTemp1Seconds: prometheus.NewDesc(
+			"nvme_thermal_mgmt_temp1_seconds_total",
+			"Total Time For Thermal Management Temperature 1: the number of seconds the controller\n"+
+				"throttled while minimizing the impact on performance.",
+			labels,
+			nil,
+		),
+		nvmeThermalMgmtTemp2Seconds: prometheus.NewDesc(
+			"nvme_thermal_mgmt_temp2_seconds_total",
+			"Total Time For Thermal Management Temperature 2: the number of seconds the controller\n"+
+				"throttled regardless of the impact on performance.",
+			labels,
+			nil,
+		),
+	}
+}
+
+func (c *smartCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.nvmeCriticalWarning
+	ch <- c.nvmeTemperature
+	ch <- c.nvmeAvailSpare
+	ch <- c.nvmeSpareThresh
+	ch <- c.nvmePercentUsed
+	ch <- c.nvmeEnduranceGrpCriticalWarningSummary
+	ch <- c.nvmeDataUnitsRead
+	ch <- c.nvmeDataUnitsWritten
+	ch <- c.nvmeHostReadCommands
+	ch <- c.nvmeHostWriteCommands
+	ch <- c.nvmeControllerBusyTime
+	ch <- c.nvmePowerCycles
+	ch <- c.nvmePowerOnHours
+	ch <- c.nvmeUnsafeShutdowns
+	ch <- c.nvmeMediaErrors
+	ch <- c.nvmeNumErrLogEntries
+	ch <- c.nvmeWarningTempTime
+	ch <- c.nvmeCriticalCompTime
+	ch <- c.nvmeThmTemp1TransCount
+	ch <- c.nvmeThmTemp2TransCount
+	ch <- c.nvmeThmTemp1TotalTime
+	ch <- c.nvmeThmTemp2TotalTime
+	ch <- c.nvmeTemperatureSensorCelsius
+	ch <- c.nvmeCriticalWarningBit
+	ch <- c.nvmeEnduranceGrpCriticalWarningBit
+	ch <- c.nvmeTemperatureCelsius
+	ch <- c.nvmeAvailableSpareRatio
+	ch <- c.nvmeAvailableSpareThresholdRatio
+	ch <- c.nvmePercentageUsedRatio
+	ch <- c.nvmeReadBytes
+	ch <- c.nvmeWrittenBytes
+	ch <- c.nvmeHostReadCommandsTotal
+	ch <- c.nvmeHostWriteCommandsTotal
+	ch <- c.nvmeControllerBusySeconds
+	ch <- c.nvmePowerCyclesTotal
+	ch <- c.nvmePowerOnSeconds
+	ch <- c.nvmeUnsafeShutdownsTotal
+	ch <- c.nvmeMediaErrorsTotal
+	ch <- c.nvmeNumErrLogEntriesTotal
+	ch <- c.nvmeWarningTemperatureSeconds
+	ch <- c.nvmeCriticalTemperatureSeconds
+	ch <- c.nvmeThermalMgmtTemp1Transitions
+	ch <- c.nvmeThermalMgmtTemp2Transitions
+	ch <- c.nvmeThermalMgmtTemp1Seconds
+	ch <- c.nvmeThermalMgmtTemp2Seconds
+}
+
+func (c *smartCollector) Update(ctx context.Context, t target, ch chan<- prometheus.Metric) error {
+	controller := t.controller
+	smartLog, err := c.backend.SmartLog(ctx, controller.Path)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.nvmeCriticalWarning, prometheus.GaugeValue, smartLog.CriticalWarning, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeEnduranceGrpCriticalWarningSummary, prometheus.GaugeValue, smartLog.EnduranceGrpCriticalWarningSummary, controller.Model, controller.Name, controller.Subsystem)
+	for _, b := range criticalWarningBits {
+		set := uint(smartLog.CriticalWarning) >> b.bit & 1
+		ch <- prometheus.MustNewConstMetric(c.nvmeCriticalWarningBit, prometheus.GaugeValue, float64(set), controller.Model, controller.Name, controller.Subsystem, b.name)
+	}
+	for _, b := range enduranceGrpCriticalWarningBits {
+		set := uint(smartLog.EnduranceGrpCriticalWarningSummary) >> b.bit & 1
+		ch <- prometheus.MustNewConstMetric(c.nvmeEnduranceGrpCriticalWarningBit, prometheus.GaugeValue, float64(set), controller.Model, controller.Name, controller.Subsystem, b.name)
+	}
+	// 0 Kelvin means the controller reports no temperature, e.g. nvmet
+	if smartLog.Temperature != 0 {
+		ch <- prometheus.MustNewConstMetric(c.nvmeTemperatureCelsius, prometheus.GaugeValue, kelvinToCelsius(smartLog.Temperature), controller.Model, controller.Name, controller.Subsystem)
+	}
+	ch <- prometheus.MustNewConstMetric(c.nvmeAvailableSpareRatio, prometheus.GaugeValue, smartLog.AvailSpare/100, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeAvailableSpareThresholdRatio, prometheus.GaugeValue, smartLog.SpareThresh/100, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmePercentageUsedRatio, prometheus.GaugeValue, smartLog.PercentUsed/100, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeReadBytes, prometheus.CounterValue, smartLog.DataUnitsRead*dataUnitBytes, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeWrittenBytes, prometheus.CounterValue, smartLog.DataUnitsWritten*dataUnitBytes, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeHostReadCommandsTotal, prometheus.CounterValue, smartLog.HostReadCommands, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeHostWriteCommandsTotal, prometheus.CounterValue, smartLog.HostWriteCommands, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeControllerBusySeconds, prometheus.CounterValue, smartLog.ControllerBusyTime*60, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmePowerCyclesTotal, prometheus.CounterValue, smartLog.PowerCycles, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmePowerOnSeconds, prometheus.CounterValue, smartLog.PowerOnHours*3600, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeUnsafeShutdownsTotal, prometheus.CounterValue, smartLog.UnsafeShutdowns, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeMediaErrorsTotal, prometheus.CounterValue, smartLog.MediaErrors, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeNumErrLogEntriesTotal, prometheus.CounterValue, smartLog.NumErrLogEntries, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeWarningTemperatureSeconds, prometheus.CounterValue, smartLog.WarningTempTime*60, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeCriticalTemperatureSeconds, prometheus.CounterValue, smartLog.CriticalCompTime*60, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeThermalMgmtTemp1Transitions, prometheus.CounterValue, smartLog.ThmTemp1TransCount, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeThermalMgmtTemp2Transitions, prometheus.CounterValue, smartLog.ThmTemp2TransCount, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeThermalMgmtTemp1Seconds, prometheus.CounterValue, smartLog.ThmTemp1TotalTime, controller.Model, controller.Name, controller.Subsystem)
+	ch <- prometheus.MustNewConstMetric(c.nvmeThermalMgmtTemp2Seconds, prometheus.CounterValue, smartLog.ThmTemp2TotalTime, controller.Model, controller.Name, controller.Subsystem)
+	for idx, kelvin := range smartLog.TemperatureSensors {
+		if kelvin == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.nvmeTemperatureSensorCelsius, prometheus.GaugeValue, kelvinToCelsius(kelvin), controller.Model, controller.Name, controller.Subsystem, strconv.Itoa(idx+1))
+	}
+
+	if c.legacyNames {
+		ch <- prometheus.MustNewConstMetric(c.nvmeTemperature, prometheus.GaugeValue, smartLog.Temperature, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeAvailSpare, prometheus.GaugeValue, smartLog.AvailSpare, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeSpareThresh, prometheus.GaugeValue, smartLog.SpareThresh, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmePercentUsed, prometheus.GaugeValue, smartLog.PercentUsed, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeDataUnitsRead, prometheus.CounterValue, smartLog.DataUnitsRead, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeDataUnitsWritten, prometheus.CounterValue, smartLog.DataUnitsWritten, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeHostReadCommands, prometheus.CounterValue, smartLog.HostReadCommands, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeHostWriteCommands, prometheus.CounterValue, smartLog.HostWriteCommands, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeControllerBusyTime, prometheus.CounterValue, smartLog.ControllerBusyTime, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmePowerCycles, prometheus.CounterValue, smartLog.PowerCycles, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmePowerOnHours, prometheus.CounterValue, smartLog.PowerOnHours, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeUnsafeShutdowns, prometheus.CounterValue, smartLog.UnsafeShutdowns, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeMediaErrors, prometheus.CounterValue, smartLog.MediaErrors, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeNumErrLogEntries, prometheus.CounterValue, smartLog.NumErrLogEntries, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeWarningTempTime, prometheus.CounterValue, smartLog.WarningTempTime, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeCriticalCompTime, prometheus.CounterValue, smartLog.CriticalCompTime, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeThmTemp1TransCount, prometheus.CounterValue, smartLog.ThmTemp1TransCount, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeThmTemp2TransCount, prometheus.CounterValue, smartLog.ThmTemp2TransCount, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeThmTemp1TotalTime, prometheus.CounterValue, smartLog.ThmTemp1TotalTime, controller.Model, controller.Name, controller.Subsystem)
+		ch <- prometheus.MustNewConstMetric(c.nvmeThmTemp2TotalTime, prometheus.CounterValue, smartLog.ThmTemp2TotalTime, controller.Model, controller.Name, controller.Subsystem)
+	}
+	return nil
+}
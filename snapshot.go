@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// snapshot holds the device states of the last background refresh
+type snapshot struct {
+	staleness time.Duration
+
+	mu          sync.Mutex
+	devices     []*deviceState
+	lastRefresh time.Time
+}
+
+// startRefresh switches the collector to serve cached snapshots which are
+// refreshed in the background every interval
+func (c *nvmeCollector) startRefresh(interval, staleness time.Duration) {
+	c.snapshot = &snapshot{staleness: staleness}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.refresh()
+			<-ticker.C
+		}
+	}()
+}
+
+func (c *nvmeCollector) refresh() {
+	states, ok := c.scrape()
+	if !ok {
+		return
+	}
+	c.snapshot.update(states, time.Now())
+}
+
+// update replaces the cached devices, collectors which failed this time keep
+// their last good metrics until they become stale
+func (s *snapshot) update(states []*deviceState, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := make(map[string]*deviceState, len(s.devices))
+	for _, state := range s.devices {
+		previous[state.target.path()] = state
+	}
+	for _, state := range states {
+		if prev, ok := previous[state.target.path()]; ok && !state.success {
+			state.inherit(prev)
+		}
+	}
+	s.devices = states
+	s.lastRefresh = now
+}
+
+// states returns the cached devices, dropping everything that is older than
+// the staleness cutoff
+func (s *snapshot) states(now time.Time) ([]*deviceState, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastRefresh.IsZero() || now.Sub(s.lastRefresh) > s.staleness {
+		return nil, s.lastRefresh
+	}
+	states := make([]*deviceState, 0, len(s.devices))
+	for _, state := range s.devices {
+		states = append(states, state.withoutStale(now.Add(-s.staleness)))
+	}
+	return states, s.lastRefresh
+}
+
+func (c *nvmeCollector) collectSnapshot(ch chan<- prometheus.Metric) {
+	states, lastRefresh := c.snapshot.states(time.Now())
+	if !lastRefresh.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.nvmeLastRefreshTimestamp, prometheus.GaugeValue, float64(lastRefresh.UnixNano())/1e9)
+	}
+	if states != nil {
+		c.collectStates(ch, states)
+	}
+}
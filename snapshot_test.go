@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestSnapshotKeepsFreshResults checks that a collector failing on every
+// refresh does not make the cached results of the other collectors stale
+func TestSnapshotKeepsFreshResults(t *testing.T) {
+	desc := prometheus.NewDesc("nvme_test", "Test metric.", nil, nil)
+	metric := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1)
+	start := time.Unix(1700000000, 0)
+	s := &snapshot{staleness: 5 * time.Minute}
+
+	state := func(at time.Time, errorLogSuccess bool) []*deviceState {
+		errorLog := &collectorResult{}
+		if errorLogSuccess {
+			errorLog = &collectorResult{success: true, metrics: []prometheus.Metric{metric}, refreshed: at}
+		}
+		return []*deviceState{{
+			success: errorLogSuccess,
+			results: map[string]*collectorResult{
+				"smart":     {success: true, metrics: []prometheus.Metric{metric}, refreshed: at},
+				"error-log": errorLog,
+			},
+		}}
+	}
+	s.update(state(start, true), start)
+	for i := 1; i <= 10; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		s.update(state(at, false), at)
+	}
+
+	states, _ := s.states(start.Add(10 * time.Minute))
+	if len(states) != 1 {
+		t.Fatalf("got %d states, want 1", len(states))
+	}
+	if got := len(states[0].results["smart"].metrics); got != 1 {
+		t.Errorf("got %d smart metrics, want the fresh one", got)
+	}
+	if got := len(states[0].results["error-log"].metrics); got != 0 {
+		t.Errorf("got %d error-log metrics, want the stale ones dropped", got)
+	}
+}
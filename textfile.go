@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// textfileWriter writes the metrics of its collectors to a file for the
+// node_exporter textfile collector instead of serving them over HTTP
+type textfileWriter struct {
+	filename  string
+	registry  *prometheus.Registry
+	timestamp prometheus.Gauge
+}
+
+// newTextfileWriter uses its own registry so that the file does not carry
+// go and process metrics clashing with those of node_exporter
+func newTextfileWriter(filename string, collectors ...prometheus.Collector) (*textfileWriter, error) {
+	w := &textfileWriter{
+		filename: filename,
+		registry: prometheus.NewRegistry(),
+		timestamp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nvme_textfile_write_timestamp_seconds",
+			Help: "Unix time the exporter collected the metrics of the textfile.",
+		}),
+	}
+	if err := w.registry.Register(w.timestamp); err != nil {
+		return nil, err
+	}
+	for _, c := range collectors {
+		if err := w.registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// write collects once and replaces the file atomically, readers see either
+// the previous or the new contents
+func (w *textfileWriter) write() error {
+	w.timestamp.SetToCurrentTime()
+	return prometheus.WriteToTextfile(w.filename, w.registry)
+}
+
+// run writes the file every interval, failed writes keep the previous file
+func (w *textfileWriter) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.write(); err != nil {
+			log.Printf("Error writing textfile %s: %s\n", w.filename, err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// webConfig is the --web.config.file contents, it follows the web
+// configuration file format of the Prometheus exporter-toolkit
+type webConfig struct {
+	TLSServerConfig *tlsServerConfig  `yaml:"tls_server_config"`
+	BasicAuthUsers  map[string]string `yaml:"basic_auth_users"`
+}
+
+type tlsServerConfig struct {
+	CertFile       string      `yaml:"cert_file"`
+	KeyFile        string      `yaml:"key_file"`
+	ClientAuthType string      `yaml:"client_auth_type"`
+	ClientCAFile   string      `yaml:"client_ca_file"`
+	MinVersion     tlsVersion  `yaml:"min_version"`
+	MaxVersion     tlsVersion  `yaml:"max_version"`
+	CipherSuites   []tlsCipher `yaml:"cipher_suites"`
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+// tlsVersion is a TLS version given by name, e.g. TLS12
+type tlsVersion uint16
+
+func (v *tlsVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	version, ok := tlsVersions[name]
+	if !ok {
+		return fmt.Errorf("unknown TLS version: %s", name)
+	}
+	*v = tlsVersion(version)
+	return nil
+}
+
+// tlsCipher is a cipher suite given by its Go name, e.g.
+// TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+type tlsCipher uint16
+
+func (c *tlsCipher) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			*c = tlsCipher(suite.ID)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown cipher suite: %s", name)
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+func loadWebConfig(filename string) (*webConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := webConfig{
+		TLSServerConfig: &tlsServerConfig{MinVersion: tls.VersionTLS12},
+	}
+	if err := yaml.UnmarshalStrict(content, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing web config file %s: %s", filename, err)
+	}
+	// an empty or null tls_server_config leaves TLS disabled
+	if cfg.TLSServerConfig == nil {
+		cfg.TLSServerConfig = &tlsServerConfig{MinVersion: tls.VersionTLS12}
+	}
+	// relative paths are relative to the config file
+	dir := filepath.Dir(filename)
+	for _, path := range []*string{&cfg.TLSServerConfig.CertFile, &cfg.TLSServerConfig.KeyFile, &cfg.TLSServerConfig.ClientCAFile} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	return &cfg, nil
+}
+
+// enabled reports whether TLS is configured
+func (c *tlsServerConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// tlsConfig builds the server TLS configuration. The certificate and key
+// are read again on every handshake so they can be rotated without a
+// restart.
+func (c *tlsServerConfig) tlsConfig() (*tls.Config, error) {
+	if c.CertFile == "" {
+		return nil, fmt.Errorf("missing cert_file")
+	}
+	if c.KeyFile == "" {
+		return nil, fmt.Errorf("missing key_file")
+	}
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return nil, fmt.Errorf("error loading certificate: %s", err)
+	}
+	clientAuth, ok := clientAuthTypes[c.ClientAuthType]
+	if !ok {
+		return nil, fmt.Errorf("unknown client_auth_type: %s", c.ClientAuthType)
+	}
+	cfg := &tls.Config{
+		MinVersion: uint16(c.MinVersion),
+		MaxVersion: uint16(c.MaxVersion),
+		ClientAuth: clientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("error loading certificate: %s", err)
+			}
+			return &cert, nil
+		},
+	}
+	for _, cipher := range c.CipherSuites {
+		cfg.CipherSuites = append(cfg.CipherSuites, uint16(cipher))
+	}
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client_ca_file: %s", err)
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client_ca_file %s", c.ClientCAFile)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_auth_type %s requires client_ca_file", c.ClientAuthType)
+	}
+	return cfg, nil
+}
+
+// authCacheSize bounds the number of successful logins remembered, an
+// arbitrary entry is dropped when it is reached
+const authCacheSize = 100
+
+// basicAuthHandler requires one of users, which maps user names to bcrypt
+// hashed passwords, before calling next
+type basicAuthHandler struct {
+	users map[string]string
+	next  http.Handler
+
+	mu sync.Mutex
+	// cache holds the successful logins, bcrypt is too slow to be run on
+	// every scrape
+	cache map[string]struct{}
+}
+
+// authenticated reports whether password matches hash, remembering matches
+// by a digest of user, hash and password
+func (h *basicAuthHandler) authenticated(user, hash, password string) bool {
+	sum := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + password))
+	key := hex.EncodeToString(sum[:])
+
+	h.mu.Lock()
+	_, cached := h.cache[key]
+	h.mu.Unlock()
+	if cached {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cache == nil {
+		h.cache = map[string]struct{}{}
+	}
+	if len(h.cache) >= authCacheSize {
+		for k := range h.cache {
+			delete(h.cache, k)
+			break
+		}
+	}
+	h.cache[key] = struct{}{}
+	return true
+}
+
+// dummyHash is compared against for unknown users so that the response
+// time does not reveal which users exist
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("nvme_exporter"), bcrypt.DefaultCost)
+
+func (h *basicAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if ok {
+		hash, known := h.users[user]
+		if !known {
+			hash = string(dummyHash)
+		}
+		if h.authenticated(user, hash, password) && known {
+			h.next.ServeHTTP(w, r)
+			return
+		}
+	}
+	w.Header().Set("WWW-Authenticate", "Basic")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// listenAndServe serves handler on address, with TLS and basic auth if
+// configured in the web config file
+func listenAndServe(address string, webConfigFile string, handler http.Handler) error {
+	if webConfigFile == "" {
+		return http.ListenAndServe(address, handler)
+	}
+	cfg, err := loadWebConfig(webConfigFile)
+	if err != nil {
+		return err
+	}
+	if len(cfg.BasicAuthUsers) > 0 {
+		handler = &basicAuthHandler{users: cfg.BasicAuthUsers, next: handler}
+	}
+	server := &http.Server{Addr: address, Handler: handler}
+	if !cfg.TLSServerConfig.enabled() {
+		return server.ListenAndServe()
+	}
+	server.TLSConfig, err = cfg.TLSServerConfig.tlsConfig()
+	if err != nil {
+		return fmt.Errorf("error in tls_server_config of %s: %s", webConfigFile, err)
+	}
+	return server.ListenAndServeTLS("", "")
+}
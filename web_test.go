@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &basicAuthHandler{
+		users: map[string]string{"prometheus": string(hash)},
+		next:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	}
+
+	for _, tc := range []struct {
+		user, password string
+		want           int
+	}{
+		{"prometheus", "secret", http.StatusOK},
+		// served from the cache
+		{"prometheus", "secret", http.StatusOK},
+		{"prometheus", "wrong", http.StatusUnauthorized},
+		{"nvme_exporter", "nvme_exporter", http.StatusUnauthorized},
+		{"nvme_exporter", "nvme_exporter", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.SetBasicAuth(tc.user, tc.password)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s:%s: got status %d, want %d", tc.user, tc.password, w.Code, tc.want)
+		}
+	}
+	if len(h.cache) != 2 {
+		t.Errorf("got %d cached logins, want 2", len(h.cache))
+	}
+}
+
+func TestLoadWebConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		content string
+		tls     bool
+	}{
+		{"", false},
+		{"tls_server_config: null\n", false},
+		{"tls_server_config:\n", false},
+		{"basic_auth_users: {prometheus: hash}\n", false},
+		{"tls_server_config: {cert_file: tls.crt, key_file: tls.key}\n", true},
+	} {
+		filename := filepath.Join(dir, "web.yml")
+		if err := ioutil.WriteFile(filename, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := loadWebConfig(filename)
+		if err != nil {
+			t.Errorf("%q: %s", tc.content, err)
+			continue
+		}
+		if cfg.TLSServerConfig.enabled() != tc.tls {
+			t.Errorf("%q: got TLS enabled %t, want %t", tc.content, cfg.TLSServerConfig.enabled(), tc.tls)
+		}
+		if cfg.TLSServerConfig.MinVersion != tls.VersionTLS12 {
+			t.Errorf("%q: got min version %x, want TLS 1.2", tc.content, cfg.TLSServerConfig.MinVersion)
+		}
+	}
+}